@@ -0,0 +1,162 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// serveAdmin serves the admin HTTP endpoint on the admin listener until
+// the provided context is cancelled.
+func (p *Proxy) serveAdmin(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("POST /servers/{hostname}/drain", func(w http.ResponseWriter, r *http.Request) {
+		p.handleDrain(ctx, w, r)
+	})
+	mux.HandleFunc("DELETE /servers/{hostname}/drain", p.handleUndrain)
+	mux.HandleFunc("POST /servers/{hostname}/reset", p.handleReset)
+	mux.HandleFunc("GET /servers/{hostname}/history", p.handleHistory)
+
+	srv := &http.Server{
+		Handler:           requireToken(p.config.AdminToken, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck // Why: Best effort.
+	}()
+
+	p.log.Info("Admin endpoint started", "address", p.config.AdminAddress)
+	if err := srv.Serve(p.adminListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "failed to serve admin endpoint")
+	}
+
+	return nil
+}
+
+// requireToken wraps the provided handler, rejecting requests without
+// the provided bearer token. If token is empty, all requests are allowed.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// server returns the server with the provided hostname, or nil if there
+// isn't one.
+func (p *Proxy) server(hostname string) *Server {
+	for _, s := range p.servers {
+		if s.config.Hostname == hostname {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// handleDrain puts a server into drain mode and starts draining it in
+// the background. The server stays in drain mode, not accepting new
+// players, until handleUndrain is called.
+func (p *Proxy) handleDrain(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	s := p.server(r.PathValue("hostname"))
+	if s == nil {
+		http.Error(w, "unknown server", http.StatusNotFound)
+		return
+	}
+
+	timeout := p.config.Drain.Timeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+	}
+
+	go func() {
+		if err := s.Drain(ctx, timeout); err != nil {
+			s.log.Warn("Failed to drain server", "err", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleUndrain takes a server out of drain mode, accepting new players
+// again.
+func (p *Proxy) handleUndrain(w http.ResponseWriter, r *http.Request) {
+	s := p.server(r.PathValue("hostname"))
+	if s == nil {
+		http.Error(w, "unknown server", http.StatusNotFound)
+		return
+	}
+
+	s.SetDraining(false)
+	s.log.Info("Server is no longer draining")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReset clears a server that failed to start, so it's started again
+// the next time a player joins.
+func (p *Proxy) handleReset(w http.ResponseWriter, r *http.Request) {
+	s := p.server(r.PathValue("hostname"))
+	if s == nil {
+		http.Error(w, "unknown server", http.StatusNotFound)
+		return
+	}
+
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHistory returns a server's most recent events, such as
+// preemptions, as JSON.
+func (p *Proxy) handleHistory(w http.ResponseWriter, r *http.Request) {
+	s := p.server(r.PathValue("hostname"))
+	if s == nil {
+		http.Error(w, "unknown server", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.History()); err != nil {
+		s.log.Warn("Failed to write history", "err", err)
+	}
+}
@@ -18,15 +18,20 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"time"
 
 	"charm.land/log/v2"
 	mcnet "github.com/Tnze/go-mc/net"
 	pk "github.com/Tnze/go-mc/net/packet"
 	"github.com/function61/gokit/io/bidipipe"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/proxyproto"
 )
 
 // Connection is a connection to our proxy instance.
@@ -43,6 +48,18 @@ type Connection struct {
 	// connection.
 	h *minecraft.Handshake
 
+	// login is the login start packet the client sent, if the client is
+	// logging in.
+	login *minecraft.LoginStart
+
+	// profile is the verified profile of the player, if the proxy
+	// authenticated them, see authenticate.
+	profile *minecraft.Profile
+
+	// captures contains the named captures of the regex route that
+	// routed the connection, if any.
+	captures map[string]string
+
 	// hooks contains hooks that are called when certain events happen
 	// on the connection.
 	hooks *ConnectionHooks
@@ -65,12 +82,38 @@ type ConnectionHooks struct {
 }
 
 // NewConnection creates a new connection to the provided server. The
-// provided handshake is replayed to the server.
+// provided handshake is replayed to the server. captures are the named
+// captures of the route that routed the connection, if any.
 //
 //nolint:gocritic // Why: OK shadowing log.
 func NewConnection(mc *minecraft.Client, log *log.Logger, s *Server,
-	h *minecraft.Handshake, hooks *ConnectionHooks) *Connection {
-	return &Connection{mc, log, s, h, hooks}
+	h *minecraft.Handshake, captures map[string]string, hooks *ConnectionHooks) *Connection {
+	return &Connection{Client: mc, log: log, s: s, h: h, captures: captures, hooks: hooks}
+}
+
+// message renders the message with the provided key for this
+// connection.
+func (c *Connection) message(key string) *minecraft.Chat {
+	vars := &messageVars{
+		Server:         c.s.config.Hostname,
+		Captures:       c.captures,
+		State:          string(c.s.State()),
+		ProviderStatus: string(c.s.ProviderStatus()),
+		ETA:            c.s.readyIn(),
+		DrainIn:        c.s.drainIn(),
+	}
+	if c.h != nil {
+		vars.Address = c.h.ServerAddress
+	}
+	if c.login != nil {
+		vars.Player = c.login.Name
+	}
+	if until, ok := c.s.schedule.blackoutUntil(time.Now()); ok {
+		vars.AvailableAt = until
+		vars.AvailableIn = time.Until(until).Round(time.Second)
+	}
+
+	return c.s.messages.render(key, vars)
 }
 
 // Close closes the connection
@@ -87,26 +130,58 @@ func (c *Connection) Close() error {
 //
 // If the server is not running, it returns a status response with
 // the server's status.
-func (c *Connection) status(_ context.Context, status cloud.ProviderStatus) error {
+func (c *Connection) status(_ context.Context, state State) error {
 	if c.hooks.OnStatus != nil {
 		c.hooks.OnStatus()
 	}
 
+	// send the status back to the client
+	return errors.Wrap(c.SendStatus(c.buildStatus(state)), "failed to send status response")
+}
+
+// legacyStatus answers a legacy (pre-1.7) server list ping with the
+// same information as status.
+func (c *Connection) legacyStatus(ctx context.Context, ping *minecraft.LegacyPing) error {
+	if c.hooks.OnStatus != nil {
+		c.hooks.OnStatus()
+	}
+
+	state, err := c.s.Refresh(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get server status")
+	}
+
+	return errors.Wrap(c.SendLegacyStatus(ping, c.buildStatus(state)), "failed to send legacy status response")
+}
+
+// buildStatus returns the status to show to clients for a server in the
+// provided state. If the server is running, the status is fetched from
+// the server.
+func (c *Connection) buildStatus(state State) *minecraft.Status {
 	var mcStatus *minecraft.Status
 
 	// attempt to get the status of the server from the server
-	if status == cloud.StatusRunning {
+	if state.running() {
+		wasReady := c.s.IsReady()
+
+		var ready bool
 		var err error
-		mcStatus, err = c.s.GetMinecraftStatus()
-		if err != nil {
-			c.log.Warn("Failed to get server status", "err", err)
-			status = cloud.StatusUnknown
-		} else if mcStatus.Version != nil {
+		mcStatus, ready, err = c.s.CachedProbe()
+		switch {
+		case err != nil:
+			if wasReady {
+				c.log.Warn("Failed to get server status", "err", err)
+			}
+			state = StateWarmingUp
+		case !ready:
+			// Don't show the server as online until it's ready.
+			mcStatus = nil
+			state = StateWarmingUp
+		case mcStatus.Version != nil:
 			c.log.Debug("Fetched remote server information",
 				"version.name", mcStatus.Version.Name,
 				"version.protocol", mcStatus.Version.Protocol,
 			)
-			c.s.lastMinecraftStatus.Store(mcStatus)
 		}
 	}
 
@@ -114,51 +189,210 @@ func (c *Connection) status(_ context.Context, status cloud.ProviderStatus) erro
 	if mcStatus == nil {
 		// Not running, or something else, build a status
 		// response with the server offline.
-		v := &minecraft.StatusVersion{
-			Name: "unknown",
-			// TODO(jaredallard): How do we handle this? 754 works
-			// for 1.16.5+ but not below.
-			Protocol: 754,
+		mcStatus = c.s.offlineStatus(state, c.ProtocolVersion)
+	}
+
+	return mcStatus
+}
+
+// isWhitelisted checks to see if the player is whitelisted on the server.
+// Players are matched by name or, if the proxy authenticated them, by
+// UUID. The UUID sent by clients isn't verified, so it's never used.
+//
+// Unless the player was authenticated, this isn't a security boundary:
+// anyone can claim any name, and only a server in online mode verifies
+// it once the player is let through.
+func (c *Connection) isWhitelisted(login *minecraft.LoginStart) bool {
+	name := login.Name
+	if c.profile != nil {
+		name = c.profile.Name
+	}
+
+	for _, entry := range c.s.config.Whitelist {
+		if entry == name {
+			return true
 		}
 
-		// attempt to read the version information out of the last status
-		// we received from the server.
-		if c.s.lastMinecraftStatus.Load() != nil {
-			lastMcStatus := c.s.lastMinecraftStatus.Load()
-			v = lastMcStatus.Version
+		if id, err := uuid.Parse(entry); err == nil && c.profile != nil && id == c.profile.ID {
+			return true
 		}
+	}
 
-		mcStatus = &minecraft.Status{
-			Version: v,
-			Players: &minecraft.StatusPlayers{
-				Max:    0,
-				Online: 0,
-			},
-			Description: &minecraft.StatusDescription{
-				Text: fmt.Sprintf("Server status: %s", status),
-			},
+	return false
+}
+
+// authenticate authenticates the player with Mojang's session server,
+// see minecraft.Client.Authenticate, storing their profile. If the
+// player isn't authenticated, they're disconnected and false is
+// returned.
+func (c *Connection) authenticate(ctx context.Context, login *minecraft.LoginStart) (bool, error) {
+	profile, err := c.Authenticate(ctx, c.s.auth, login)
+	if errors.Is(err, minecraft.ErrNotAuthenticated) {
+		c.log.Info("Player is not authenticated, disconnecting")
+		return false, errors.Wrap(c.SendDisconnect(c.message(config.MessageNotAuthenticated)), "failed to send disconnect message")
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to authenticate player")
+	}
+
+	c.log.Debug("Authenticated player", "name", profile.Name, "uuid", profile.ID)
+	c.profile = profile
+	return true, nil
+}
+
+// playerProfile returns the profile of the player, as it's forwarded to
+// the remote server or used to park them: their verified profile if the
+// proxy authenticated them, otherwise an offline mode profile for the
+// name they claim.
+func (c *Connection) playerProfile() *minecraft.Profile {
+	if c.profile != nil {
+		return c.profile
+	}
+	return &minecraft.Profile{ID: minecraft.OfflineUUID(c.login.Name), Name: c.login.Name}
+}
+
+// hold keeps the connection open until the server is ready to accept
+// players. If the server isn't available before the
+// configured hold timeout, the client is disconnected and false is
+// returned.
+func (c *Connection) hold(ctx context.Context) (bool, error) {
+	hconf := c.s.config.Hold
+	c.log.Info("Holding connection while server starts", "timeout", hconf.Timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, hconf.Timeout)
+	defer cancel()
+
+	if err := c.s.WaitForReady(ctx, hconf.PollInterval); err != nil {
+		key := c.waitFailedMessage(err)
+		if key == "" {
+			return false, err
 		}
+
+		if err := c.SendDisconnect(c.message(key)); err != nil {
+			return false, errors.Wrap(err, "failed to send disconnect message")
+		}
+
+		return false, nil
 	}
 
-	// send the status back to the client
-	return errors.Wrap(c.SendStatus(mcStatus), "failed to send status response")
+	c.log.Info("Server started, resuming connection")
+	return true, nil
 }
 
-// isWhitelisted checks to see if the player is whitelisted on the server.
-func (c *Connection) isWhitelisted(playerName string) bool {
-	for _, name := range c.s.config.Whitelist {
-		if name == playerName {
-			return true
+// waitFailedMessage returns the key of the message to disconnect a held,
+// or parked, player with when waiting for the server failed with the
+// provided error. An empty string is returned for unexpected errors.
+func (c *Connection) waitFailedMessage(err error) string {
+	switch {
+	case errors.Is(err, errServerFailed):
+		c.log.Info("Server failed to start, disconnecting")
+		return config.MessageFailed
+	case errors.Is(err, errServerBlackout):
+		c.log.Info("Server is in a blackout, disconnecting")
+		return config.MessageBlackout
+	case errors.Is(err, context.DeadlineExceeded):
+		c.log.Info("Server did not start in time, disconnecting")
+		return config.MessageStartTimeout
+	default:
+		return ""
+	}
+}
+
+// parkKeepAliveInterval is how often keep alives are sent to parked
+// players. Clients time out after 30 seconds without a packet.
+const parkKeepAliveInterval = 10 * time.Second
+
+// park parks the client, in an empty world or on its joining screen,
+// until the server is ready to accept players. Players in a world are
+// shown the server's progress in a boss bar. Once the server is ready,
+// the client is transferred back to the proxy or, if the client doesn't
+// support transfers, asked to reconnect. If the server isn't available
+// before the configured park timeout, the client is disconnected.
+func (c *Connection) park(ctx context.Context) error {
+	pconf := c.s.config.Park
+	c.log.Info("Parking player while server starts", "timeout", pconf.Timeout)
+
+	parked, err := c.Park(c.playerProfile())
+	if err != nil {
+		return errors.Wrap(err, "failed to park player")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pconf.Timeout)
+	defer cancel()
+
+	readyChan := make(chan error, 1)
+	go func() {
+		readyChan <- c.s.WaitForReady(ctx, pconf.PollInterval)
+	}()
+
+	// Consume packets sent by the client (keep alive responses, client
+	// settings, etc.) and notice when it goes away.
+	clientChan := make(chan error, 1)
+	go func() {
+		clientChan <- parked.Discard()
+	}()
+
+	keepAlive := time.NewTicker(parkKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	// Players parked in a world are shown the server's progress, updated
+	// every poll. Others never receive from the nil channel.
+	var statusChan <-chan time.Time
+	if parked.InWorld() {
+		if err := c.showParkedStatus(parked); err != nil {
+			return err
 		}
+
+		status := time.NewTicker(pconf.PollInterval)
+		defer status.Stop()
+		statusChan = status.C
 	}
 
-	return false
+	for {
+		select {
+		case <-keepAlive.C:
+			if err := parked.KeepAlive(); err != nil {
+				return errors.Wrap(err, "failed to send keep alive")
+			}
+		case <-statusChan:
+			if err := c.showParkedStatus(parked); err != nil {
+				return err
+			}
+		case err := <-clientChan:
+			c.log.Info("Parked player left", "err", err)
+			return nil
+		case err := <-readyChan:
+			if err != nil {
+				key := c.waitFailedMessage(err)
+				if key == "" {
+					return err
+				}
+
+				return errors.Wrap(parked.Disconnect(c.message(key)), "failed to send disconnect message")
+			}
+
+			if parked.CanTransfer() {
+				c.log.Info("Server started, transferring player")
+				return errors.Wrap(parked.Transfer(c.h.ServerAddress, c.h.ServerPort), "failed to transfer player")
+			}
+
+			c.log.Info("Server started, asking player to reconnect")
+			return errors.Wrap(parked.Disconnect(c.message(config.MessageStarted)), "failed to send disconnect message")
+		}
+	}
+}
+
+// showParkedStatus shows the server's progress to a player parked in a
+// world, see minecraft.Parked.ShowStatus.
+func (c *Connection) showParkedStatus(parked *minecraft.Parked) error {
+	err := parked.ShowStatus(c.message(config.MessageParked), c.s.bootProgress())
+	return errors.Wrap(err, "failed to show server status")
 }
 
 // checkState checks the state of the connection to see if we should send
 // a status response, or if we should start a server.
 func (c *Connection) checkState(ctx context.Context, state minecraft.ClientState) (replay []*pk.Packet, err error) {
-	status, err := c.s.GetStatus(ctx)
+	serverState, err := c.s.Refresh(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get server status")
 	}
@@ -169,58 +403,204 @@ func (c *Connection) checkState(ctx context.Context, state minecraft.ClientState
 		stateStr = "check (status)"
 	case minecraft.ClientStatePlayerLogin:
 		stateStr = "login"
+	case minecraft.ClientStateTransfer:
+		stateStr = "transfer"
 	}
 	c.log.Debug("Client post-handshake state", "state", stateStr)
 
 	switch state {
 	case minecraft.ClientStateCheck: // Status request
-		return nil, c.status(ctx, status)
-	case minecraft.ClientStatePlayerLogin: // Login request
-		// read the next packet to get the login information
-		login, originalLogin, err := c.ReadLoginStart()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read login packet")
+		return nil, c.status(ctx, serverState)
+	case minecraft.ClientStatePlayerLogin, minecraft.ClientStateTransfer: // Login request
+		return c.handleLogin(ctx, serverState)
+	default:
+		return nil, errors.Errorf("unknown client state: %d", state)
+	}
+}
+
+// handleLogin handles a client that's logging in, starting the server
+// if needed. If the player may join the server, the packets to replay
+// to it are returned. Otherwise, the player is disconnected and nothing
+// is returned.
+func (c *Connection) handleLogin(ctx context.Context, serverState State) ([]*pk.Packet, error) {
+	// read the next packet to get the login information
+	login, originalLogin, err := c.ReadLoginStart()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read login packet")
+	}
+	c.login = login
+
+	// Verified identities are forwarded, if the proxy authenticates
+	// players.
+	if c.s.auth != nil {
+		ok, err := c.authenticate(ctx, login)
+		if err != nil || !ok {
+			return nil, err
 		}
+	}
 
-		// HACK: We'll want a better framework for "plugins" like this than
-		// checkState.
-		if len(c.s.config.Whitelist) > 0 {
-			if !c.isWhitelisted(login.Name) {
-				c.log.Info("Player is not whitelisted, disconnecting")
-				if err := c.SendDisconnect("You are not whitelisted on this server"); err != nil {
-					return nil, errors.Wrap(err, "failed to send disconnect message")
-				}
+	if key := c.checkLogin(login); key != "" {
+		return nil, errors.Wrap(c.SendDisconnect(c.message(key)), "failed to send disconnect message")
+	}
 
-				// We don't want to send the login packet to the server
-				return nil, nil
-			}
-		}
+	if c.hooks.OnLogin != nil {
+		c.hooks.OnLogin(login)
+	}
+
+	// The server may have become ready since we last checked, so
+	// probe it before treating it as starting.
+	if serverState == StateWarmingUp {
+		c.s.Probe() //nolint:errcheck // Why: Readiness is checked below.
+	}
 
-		if c.hooks.OnLogin != nil {
-			c.hooks.OnLogin(login)
+	if !c.s.IsReady() {
+		ok, err := c.waitForServer(ctx, serverState, login)
+		if err != nil || !ok {
+			return nil, err
 		}
+	}
 
-		if status != cloud.StatusRunning {
-			c.log.Info("Server is not running, starting server")
-			if err := c.s.Start(ctx); err != nil {
-				return nil, errors.Wrap(err, "failed to start server")
-			}
+	// server is running, continue
+	return []*pk.Packet{originalLogin}, nil
+}
 
-			// send disconnect message
-			if err := c.SendDisconnect("Server is being started, please try again later"); err != nil {
-				return nil, errors.Wrap(err, "failed to send disconnect message")
-			}
+// checkLogin checks if the player may join the server right now,
+// counting them towards the server's connections if so. If they may
+// not, the key of the message to disconnect them with is returned.
+func (c *Connection) checkLogin(login *minecraft.LoginStart) string {
+	if c.s.IsDraining() {
+		c.log.Info("Server is draining, disconnecting")
+		return config.MessageDraining
+	}
+
+	// HACK: We'll want a better framework for "plugins" like this than
+	// checkLogin.
+	if len(c.s.config.Whitelist) > 0 && !c.isWhitelisted(login) {
+		c.log.Info("Player is not whitelisted, disconnecting")
+		return config.MessageNotWhitelisted
+	}
+
+	// Counting the player must be the last check, as nothing uncounts
+	// them if a later one fails.
+	if !c.s.addConnection() {
+		c.log.Info("Server is full, disconnecting", "max_players", c.s.config.MaxPlayers)
+		metrics.Add(metricServerFull, 1)
+		return config.MessageServerFull
+	}
+
+	return ""
+}
 
-			return nil, nil
+// waitForServer starts the server, if it isn't running, and then parks
+// or holds the player until it's ready, as configured. If the player
+// can't wait for the server, they're disconnected and false is
+// returned.
+func (c *Connection) waitForServer(ctx context.Context, serverState State, login *minecraft.LoginStart) (bool, error) {
+	switch serverState {
+	case StateStopped, StateUnknown:
+		if until, ok := c.s.schedule.blackoutUntil(time.Now()); ok {
+			c.log.Info("Server is in a blackout, disconnecting", "until", until)
+			return false, errors.Wrap(c.SendDisconnect(c.message(config.MessageBlackout)), "failed to send disconnect message")
 		}
 
-		// server is running, continue
-		return []*pk.Packet{originalLogin}, nil
+		c.log.Info("Server is not running, starting server")
+		if err := c.s.Start(ctx); err != nil {
+			return false, errors.Wrap(err, "failed to start server")
+		}
+	case StateFailed:
+		c.log.Info("Server failed to start, disconnecting")
+		return false, errors.Wrap(c.SendDisconnect(c.message(config.MessageFailed)), "failed to send disconnect message")
+	case StateStarting, StateWarmingUp, StateReady, StateDraining, StateStopping:
+		c.log.Info("Server is not ready yet", "state", serverState)
+	}
+
+	switch {
+	case c.s.config.Park.Enabled && minecraft.SupportsParking(c.ProtocolVersion):
+		// parking always ends with the client being disconnected or
+		// transferred, so there's nothing to proxy.
+		return false, c.park(ctx)
+	case c.s.config.Hold.Enabled:
+		ok, err := c.hold(ctx)
+		return ok, errors.Wrap(err, "failed to hold connection")
 	default:
-		return nil, errors.Errorf("unknown client state: %d", state)
+		// send disconnect message
+		return false, errors.Wrap(c.SendDisconnect(c.message(config.MessageStarting)), "failed to send disconnect message")
 	}
 }
 
+// replayHandshake returns the handshake packet to replay to the remote
+// server. This is the original handshake sent by the client, unless it
+// needs to be rewritten.
+func (c *Connection) replayHandshake() (*pk.Packet, error) {
+	address := c.h.RawServerAddress
+	state := minecraft.ClientState(c.h.NextState)
+	rewrite := false
+
+	// Transfers are replayed as regular logins, since the client was
+	// transferred to us and not to the remote server.
+	if state == minecraft.ClientStateTransfer {
+		state = minecraft.ClientStatePlayerLogin
+		rewrite = true
+	}
+
+	if c.s.config.Minecraft.Forwarding == config.ForwardingBungeeCord && c.login != nil {
+		clientIP, _, err := net.SplitHostPort(c.Socket.RemoteAddr().String())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse client address")
+		}
+
+		address, err = minecraft.BungeeCordAddress(c.h.ServerAddress, clientIP, c.playerProfile())
+		if err != nil {
+			return nil, err
+		}
+		rewrite = true
+	}
+
+	if !rewrite {
+		return c.h.Packet, nil
+	}
+	return c.h.Rewrite(address, state), nil
+}
+
+// answerVelocityForwarding answers the remote server's request for
+// player information on behalf of the client. This must be called
+// before anything else is read from the remote server. If the remote
+// server doesn't request player information, whatever it sent instead
+// is passed along to the client.
+func (c *Connection) answerVelocityForwarding(rconn *mcnet.Conn) error {
+	var p pk.Packet
+	if err := rconn.ReadPacket(&p); err != nil {
+		return errors.Wrap(err, "failed to read packet from remote")
+	}
+
+	messageID, ok := minecraft.ParseVelocityForwardingRequest(&p)
+	if !ok {
+		c.log.Warn("Remote server did not request Velocity forwarding", "id", p.ID)
+		return errors.Wrap(c.WritePacket(p), "failed to pass packet to client")
+	}
+
+	clientIP, _, err := net.SplitHostPort(c.Socket.RemoteAddr().String())
+	if err != nil {
+		return errors.Wrap(err, "failed to parse client address")
+	}
+
+	profile := c.playerProfile()
+	f := &minecraft.VelocityForwarding{
+		Secret:     []byte(c.s.config.Minecraft.ForwardingSecret),
+		ClientIP:   clientIP,
+		UUID:       profile.ID,
+		Name:       profile.Name,
+		Properties: profile.Properties,
+	}
+	resp, err := f.Response(messageID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create forwarding response")
+	}
+
+	c.log.Debug("Answering Velocity forwarding request", "message_id", messageID)
+	return errors.Wrap(rconn.WritePacket(resp), "failed to send forwarding response")
+}
+
 // Proxy proxies the connection to the server
 func (c *Connection) Proxy(ctx context.Context) error {
 	if c.hooks.OnConnect != nil {
@@ -243,17 +623,55 @@ func (c *Connection) Proxy(ctx context.Context) error {
 	}
 	defer rconn.Close()
 
+	// Tell the remote server who the original client is.
+	if sconf.ProxyProtocol != "" {
+		version, err := proxyproto.ParseVersion(sconf.ProxyProtocol)
+		if err != nil {
+			return err
+		}
+
+		h := &proxyproto.Header{
+			Version:     version,
+			Source:      c.Socket.RemoteAddr(),
+			Destination: c.Socket.LocalAddr(),
+		}
+		if _, err := h.WriteTo(rconn.Socket); err != nil {
+			return errors.Wrap(err, "failed to write PROXY protocol header")
+		}
+	}
+
+	handshake, err := c.replayHandshake()
+	if err != nil {
+		return errors.Wrap(err, "failed to build handshake")
+	}
+
 	// Replay the original handshake to the remote server
-	for _, p := range append([]*pk.Packet{c.h.Packet}, replayPackets...) {
+	for _, p := range append([]*pk.Packet{handshake}, replayPackets...) {
 		c.log.Debug("Replaying packet", "id", p.ID, "data_len", len(p.Data))
 		if err := rconn.WritePacket(*p); err != nil {
 			return errors.Wrap(err, "failed to write handshake")
 		}
 	}
 
-	// Proxy the connection to the remote server
+	if sconf.Forwarding == config.ForwardingVelocity && c.login != nil {
+		if err := c.answerVelocityForwarding(rconn); err != nil {
+			return errors.Wrap(err, "failed to forward player information")
+		}
+	}
+
+	// Authenticated clients are encrypted, while the remote server
+	// isn't, so their traffic has to go through the cipher.
+	var client io.ReadWriteCloser = c.Socket
+	if c.profile != nil {
+		client = c.Conn
+	}
+
+	// Proxy the connection to the remote server, tracking it so it can
+	// be closed if the server is drained.
+	c.s.track(c)
+	defer c.s.untrack(c)
 	if err := bidipipe.Pipe(
-		bidipipe.WithName("client", c.Socket),
+		bidipipe.WithName("client", client),
 		bidipipe.WithName("remote", rconn),
 	); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
 		return errors.Wrap(err, "failed to proxy")
@@ -0,0 +1,183 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/rcon"
+)
+
+// drainKickGrace is how long to wait for players to disconnect after
+// being kicked through RCON, before their connections are closed.
+const drainKickGrace = 2 * time.Second
+
+// rconTimeout is the timeout for connecting to, and running commands
+// through, RCON.
+const rconTimeout = 5 * time.Second
+
+// track registers a connection that is being proxied to the server, so
+// that it can be closed when the server is drained.
+func (s *Server) track(c *Connection) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	s.active[c] = struct{}{}
+}
+
+// untrack removes a connection registered with track.
+func (s *Server) untrack(c *Connection) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	delete(s.active, c)
+}
+
+// closeConnections closes all connections being proxied to the server.
+func (s *Server) closeConnections() {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+
+	for c := range s.active {
+		// Only close the socket, the connection is cleaned up once it
+		// stops being proxied.
+		c.Socket.Close()
+	}
+}
+
+// IsDraining returns true if the server is draining and not accepting
+// new players.
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// SetDraining sets whether or not the server accepts new players. A
+// running server moves between ready and draining.
+func (s *Server) SetDraining(draining bool) {
+	s.draining.Store(draining)
+	if draining {
+		s.transition(StateDraining, "drain requested", StateReady)
+		return
+	}
+
+	s.drainDeadline.Store(nil)
+	s.transition(StateReady, "drain cancelled", StateDraining)
+}
+
+// drainIn returns the time until players are disconnected from a
+// draining server. It's 0 if the server isn't draining.
+func (s *Server) drainIn() time.Duration {
+	deadline := s.drainDeadline.Load()
+	if deadline == nil {
+		return 0
+	}
+
+	return max(time.Until(*deadline), 0).Round(time.Second)
+}
+
+// Drain stops the server from accepting new players and waits for all
+// players to leave, up to the provided timeout. If RCON is configured,
+// players are notified when draining starts. Players still online at
+// the timeout, or when the context is cancelled, are kicked through
+// RCON, if configured, and then disconnected.
+func (s *Server) Drain(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	s.drainDeadline.Store(&deadline)
+	s.SetDraining(true)
+
+	if s.connections.Load() == 0 {
+		return nil
+	}
+
+	s.log.Info("Draining server", "connections", s.connections.Load(), "timeout", timeout)
+	if err := s.rconMessage(config.MessageDraining, func(msg string) string {
+		return "tellraw @a " + msg
+	}); err != nil {
+		s.log.Warn("Failed to notify players of drain", "err", err)
+	}
+
+	waitCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := s.waitForEmpty(waitCtx); err == nil {
+		s.log.Info("Server drained")
+		return nil
+	}
+
+	s.log.Warn("Players did not leave in time, disconnecting them", "connections", s.connections.Load())
+	if err := s.rconMessage(config.MessageDrainKick, func(msg string) string {
+		return "kick @a " + msg
+	}); err != nil {
+		s.log.Warn("Failed to kick players", "err", err)
+	} else {
+		// Give the server a moment to kick everyone, so they see the
+		// message rather than a lost connection.
+		graceCtx, cancel := context.WithTimeout(context.Background(), drainKickGrace)
+		defer cancel()
+		s.waitForEmpty(graceCtx) //nolint:errcheck // Why: Remaining connections are closed below.
+	}
+
+	s.closeConnections()
+	return ctx.Err()
+}
+
+// waitForEmpty blocks until the server has no connections, or the
+// context is done.
+func (s *Server) waitForEmpty(ctx context.Context) error {
+	for s.connections.Load() != 0 {
+		// wait before checking again, but also break if the context is cancelled
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return nil
+}
+
+// rconMessage renders the message with the provided key and runs the
+// command returned by cmd for it through RCON. Nothing is done if RCON
+// isn't configured.
+func (s *Server) rconMessage(key string, cmd func(msg string) string) error {
+	rconf := s.config.Minecraft.RCON
+	if rconf == nil {
+		return nil
+	}
+
+	msg := s.messages.render(key, &messageVars{Server: s.config.Hostname, DrainIn: s.drainIn()})
+
+	// tellraw takes a chat component, kick a plain text reason.
+	arg := msg.Legacy()
+	if key == config.MessageDraining {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		arg = string(b)
+	}
+
+	c, err := rcon.Dial(fmt.Sprintf("%s:%d", s.config.Minecraft.Hostname, rconf.Port), rconf.Password, rconTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to rcon")
+	}
+	defer c.Close()
+
+	_, err = c.Command(cmd(arg))
+	return errors.Wrap(err, "failed to run rcon command")
+}
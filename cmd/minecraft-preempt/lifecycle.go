@@ -0,0 +1,374 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
+)
+
+// State is the lifecycle state of a server.
+type State string
+
+// This block contains all of the states of a server.
+const (
+	// StateUnknown is the state of a server before its cloud provider
+	// status is known.
+	StateUnknown State = "UNKNOWN"
+
+	// StateStopped is the state of a server that isn't running.
+	StateStopped State = "STOPPED"
+
+	// StateStarting is the state of a server whose instance is being
+	// started by its cloud provider.
+	StateStarting State = "STARTING"
+
+	// StateWarmingUp is the state of a server whose instance is running,
+	// but whose Minecraft server hasn't answered enough status pings to
+	// accept players yet.
+	StateWarmingUp State = "WARMING UP"
+
+	// StateReady is the state of a server that accepts players.
+	StateReady State = "READY"
+
+	// StateDraining is the state of a running server that doesn't accept
+	// new players, see Server.Drain.
+	StateDraining State = "DRAINING"
+
+	// StateStopping is the state of a server whose instance is being
+	// stopped by its cloud provider.
+	StateStopping State = "STOPPING"
+
+	// StateFailed is the state of a server that failed to start, see
+	// Server.checkTimeouts. It stays failed until reset by an operator.
+	StateFailed State = "FAILED"
+)
+
+// errServerFailed is returned when waiting for a server that failed to
+// start.
+var errServerFailed = errors.New("server failed to start")
+
+// errServerBlackout is returned when waiting for a server that isn't
+// running, and can't be started because of a blackout.
+var errServerBlackout = errors.New("server can't be started during a blackout")
+
+// runningStates contains the states of a server whose instance is
+// running.
+var runningStates = []State{StateWarmingUp, StateReady, StateDraining}
+
+// running returns true if the server's instance is running.
+func (s State) running() bool {
+	return slices.Contains(runningStates, s)
+}
+
+// Transition is a change of a server's state.
+type Transition struct {
+	// From is the state the server was in.
+	From State
+
+	// To is the state the server is now in.
+	To State
+
+	// Reason describes what caused the transition.
+	Reason string
+
+	// At is when the transition happened.
+	At time.Time
+}
+
+// syncMaxAge is how long the state synced from the cloud provider is
+// trusted for by Refresh.
+const syncMaxAge = 5 * time.Second
+
+// transitionGrace is how long after the proxy starts, or stops, a server
+// the cloud provider reporting the previous status is ignored, since
+// providers take a moment to reflect the change.
+const transitionGrace = 2 * time.Minute
+
+// subscriberBuffer is the number of transitions buffered for each
+// subscriber.
+const subscriberBuffer = 16
+
+// State returns the current state of the server.
+func (s *Server) State() State {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	return s.lifecycle
+}
+
+// IsReady returns true if the Minecraft server has answered enough
+// consecutive status pings to be considered ready to accept players.
+func (s *Server) IsReady() bool {
+	state := s.State()
+	return state == StateReady || state == StateDraining
+}
+
+// Subscribe returns a channel receiving the server's state transitions
+// and a function to stop receiving them, which closes the channel.
+// Transitions are dropped if the channel's buffer is full.
+func (s *Server) Subscribe() (<-chan Transition, func()) {
+	ch := make(chan Transition, subscriberBuffer)
+
+	s.lifecycleMu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.lifecycleMu.Unlock()
+
+	unsubscribe := func() {
+		s.lifecycleMu.Lock()
+		defer s.lifecycleMu.Unlock()
+
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// transition moves the server to the provided state, if it's in one of
+// the states in from. If from is empty, the server may be in any state.
+// It returns false if the server wasn't moved, including if it's
+// already in the provided state.
+func (s *Server) transition(to State, reason string, from ...State) bool {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.lifecycle == to || (len(from) != 0 && !slices.Contains(from, s.lifecycle)) {
+		return false
+	}
+
+	t := Transition{From: s.lifecycle, To: to, Reason: reason, At: time.Now()}
+	s.lifecycle = to
+	s.lifecycleSince = t.At
+	s.log.Info("Server state changed", "from", t.From, "to", t.To, "reason", reason)
+
+	// Readiness only carries over while the instance keeps running.
+	if !to.running() {
+		s.readyProbes.Store(0)
+		s.statusCache.Store(nil)
+	}
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- t:
+		default:
+			s.log.Warn("State subscriber is not keeping up, dropping transition", "to", t.To)
+		}
+	}
+
+	return true
+}
+
+// ProviderStatus returns the status last reported by the server's cloud
+// provider, see Sync.
+func (s *Server) ProviderStatus() cloud.ProviderStatus {
+	if status := s.providerStatus.Load(); status != nil {
+		return *status
+	}
+	return cloud.StatusUnknown
+}
+
+// stateSince returns the current state of the server and when it
+// entered it.
+func (s *Server) stateSince() (State, time.Time) {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	return s.lifecycle, s.lifecycleSince
+}
+
+// Sync updates the server's state from the cloud provider's status, and
+// returns the new state.
+func (s *Server) Sync(ctx context.Context) (State, error) {
+	status, err := s.cloud.Status(ctx, s.instanceID)
+	if err != nil {
+		return s.State(), err
+	}
+	s.lastSync.Store(time.Now().UnixNano())
+	s.providerStatus.Store(&status)
+
+	current, since := s.stateSince()
+	recent := time.Since(since) < transitionGrace
+
+	// Failed servers stay failed until reset, whatever the provider says.
+	if current == StateFailed {
+		return current, nil
+	}
+
+	switch status {
+	case cloud.StatusRunning:
+		// Readiness is tracked by Probe, only notice that the instance
+		// is running.
+		if current == StateStopping && recent {
+			break
+		}
+		s.transition(StateWarmingUp, "provider reports running",
+			StateUnknown, StateStopped, StateStarting, StateStopping)
+	case cloud.StatusStarting:
+		s.transition(StateStarting, "provider reports starting")
+	case cloud.StatusStopping:
+		// The proxy moves servers to stopping before stopping them, so a
+		// running server stopping wasn't stopped by us.
+		if s.transition(StateStopping, "provider reports stopping unexpectedly", runningStates...) {
+			s.preempted(current)
+			break
+		}
+		s.transition(StateStopping, "provider reports stopping")
+	case cloud.StatusStopped:
+		if current == StateStarting && recent {
+			break
+		}
+		if s.transition(StateStopped, "provider reports stopped unexpectedly", runningStates...) {
+			s.preempted(current)
+			break
+		}
+		s.transition(StateStopped, "provider reports stopped")
+	case cloud.StatusUnknown:
+		// Keep the last known state.
+	}
+
+	return s.State(), nil
+}
+
+// Refresh returns the server's state, syncing it with the cloud provider
+// first if it hasn't been recently. Concurrent callers share a single
+// sync.
+func (s *Server) Refresh(ctx context.Context) (State, error) {
+	lastSync := time.Unix(0, s.lastSync.Load())
+	if state := s.State(); state != StateUnknown && time.Since(lastSync) < syncMaxAge {
+		return state, nil
+	}
+
+	v, err, _ := s.syncs.Do("sync", func() (any, error) {
+		return s.Sync(ctx)
+	})
+	if err != nil {
+		return s.State(), err
+	}
+
+	state, ok := v.(State)
+	if !ok {
+		return s.State(), errors.Errorf("unexpected state type %T", v)
+	}
+	return state, nil
+}
+
+// checkTimeouts handles the server taking too long to start or stop, and
+// retries failed starts once their backoff has passed.
+func (s *Server) checkTimeouts(ctx context.Context) {
+	state, since := s.stateSince()
+
+	switch state {
+	case StateStarting, StateWarmingUp:
+		startedAt := s.startedAt.Load()
+		if startedAt == nil || time.Since(*startedAt) < s.config.StartTimeout {
+			return
+		}
+
+		metrics.Add(metricStartTimeouts, 1)
+		s.startFailed(ctx, fmt.Sprintf("server did not become ready within %s", s.config.StartTimeout), true)
+	case StateStopping:
+		if time.Since(since) < s.config.StopTimeout {
+			return
+		}
+
+		s.log.Warn("Server did not stop in time, stopping it again", "timeout", s.config.StopTimeout)
+		metrics.Add(metricStopTimeouts, 1)
+		s.lifecycleMu.Lock()
+		s.lifecycleSince = time.Now()
+		s.lifecycleMu.Unlock()
+		if err := s.cloud.Stop(ctx, s.instanceID); err != nil {
+			s.log.Error("failed to stop server", "err", err)
+		}
+	case StateStopped:
+		retryAt := s.retryAt.Load()
+		if retryAt == nil || time.Now().Before(*retryAt) {
+			return
+		}
+
+		s.log.Info("Retrying server start", "attempt", s.startFailures.Load()+1)
+		if err := s.Start(ctx); err != nil {
+			s.log.Error("failed to start server", "err", err)
+		}
+	case StateUnknown, StateReady, StateDraining, StateFailed:
+	}
+}
+
+// startFailed records a failed start of the server. If the server has
+// failed to start the configured number of attempts, it's marked failed,
+// or left stopped if it was being restarted after a preemption.
+// Otherwise, a retry is scheduled. The server is stopped first if stop
+// is set.
+func (s *Server) startFailed(ctx context.Context, reason string, stop bool) {
+	retry := s.retryConfig()
+	failures := s.startFailures.Add(1)
+	s.startedAt.Store(nil)
+	s.log.Warn("Server failed to start", "reason", reason, "failures", failures, "attempts", retry.Attempts)
+
+	giveUp := false
+	switch {
+	case failures < int64(retry.Attempts):
+		// Wait Backoff before the first retry, doubling for every one
+		// after.
+		backoff := min(retry.Backoff, retry.MaxBackoff)
+		for range failures - 1 {
+			backoff = min(backoff*2, retry.MaxBackoff)
+		}
+		retryAt := time.Now().Add(backoff)
+		s.retryAt.Store(&retryAt)
+		s.log.Info("Retrying server start after backoff", "backoff", backoff)
+	case s.recovering.Swap(false):
+		// A preempted server isn't broken, so leave it for the next
+		// player to start.
+		s.log.Warn("Giving up restarting preempted server", "attempts", failures)
+		s.startFailures.Store(0)
+		s.retryAt.Store(nil)
+	default:
+		giveUp = true
+	}
+
+	// Servers given up on are stopped whatever state they're in, as
+	// failed servers are ignored until they're reset and would otherwise
+	// be left running.
+	stopping := stop && s.transition(StateStopping, reason+", stopping", StateStarting, StateWarmingUp)
+	if stopping || (stop && giveUp) {
+		if err := s.cloud.Stop(ctx, s.instanceID); err != nil {
+			s.log.Error("failed to stop server", "err", err)
+		}
+	}
+
+	if giveUp {
+		metrics.Add(metricServersFailed, 1)
+		s.transition(StateFailed, fmt.Sprintf("%s, giving up after %d attempts", reason, failures))
+	}
+}
+
+// Reset clears a failed server, so it's started again the next time a
+// player joins.
+func (s *Server) Reset() {
+	s.recovering.Store(false)
+	s.startFailures.Store(0)
+	s.retryAt.Store(nil)
+	if s.transition(StateUnknown, "reset by operator", StateFailed) {
+		// Sync with the provider on next use.
+		s.lastSync.Store(0)
+	}
+}
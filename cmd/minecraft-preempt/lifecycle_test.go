@@ -0,0 +1,122 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/log/v2"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+)
+
+// fakeProvider is a cloud provider that records the calls made to it.
+type fakeProvider struct {
+	mu     sync.Mutex
+	status cloud.ProviderStatus
+	starts int
+	stops  int
+}
+
+// Status implements cloud.Provider.
+func (p *fakeProvider) Status(_ context.Context, _ string) (cloud.ProviderStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status, nil
+}
+
+// Start implements cloud.Provider.
+func (p *fakeProvider) Start(_ context.Context, _ string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+	p.status = cloud.StatusStarting
+	return nil
+}
+
+// Stop implements cloud.Provider.
+func (p *fakeProvider) Stop(_ context.Context, _ string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stops++
+	p.status = cloud.StatusStopping
+	return nil
+}
+
+// ShouldTerminate implements cloud.Provider.
+func (p *fakeProvider) ShouldTerminate(_ context.Context) (bool, error) {
+	return false, nil
+}
+
+// newLifecycleTestServer returns a stopped server using the provided
+// cloud provider.
+func newLifecycleTestServer(provider cloud.Provider, conf config.ServerConfig) *Server {
+	return &Server{
+		cloud:          provider,
+		log:            log.New(io.Discard),
+		config:         &conf,
+		active:         make(map[*Connection]struct{}),
+		schedule:       &serverSchedule{loc: time.UTC},
+		lifecycle:      StateStopped,
+		lifecycleSince: time.Now(),
+		subscribers:    make(map[chan Transition]struct{}),
+	}
+}
+
+func TestStartTimeoutStopsServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		attempts  int
+		state     State
+		wantState State
+	}{
+		{name: "starting, retried", attempts: 2, state: StateStarting, wantState: StateStopping},
+		{name: "starting, given up", attempts: 1, state: StateStarting, wantState: StateFailed},
+		{name: "warming up, given up", attempts: 1, state: StateWarmingUp, wantState: StateFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := t.Context()
+			provider := &fakeProvider{status: cloud.StatusStopped}
+			s := newLifecycleTestServer(provider, config.ServerConfig{
+				StartTimeout: time.Minute,
+				Retry:        config.RetryConfig{Attempts: tt.attempts, Backoff: time.Second, MaxBackoff: time.Second},
+			})
+
+			if err := s.Start(ctx); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			s.transition(tt.state, "test")
+
+			// Pretend the server was started longer ago than the timeout.
+			startedAt := time.Now().Add(-2 * time.Minute)
+			s.startedAt.Store(&startedAt)
+			s.checkTimeouts(ctx)
+
+			if got := s.State(); got != tt.wantState {
+				t.Errorf("State() = %s, want %s", got, tt.wantState)
+			}
+			if provider.stops != 1 {
+				t.Errorf("provider stopped %d times, want 1", provider.stops)
+			}
+		})
+	}
+}
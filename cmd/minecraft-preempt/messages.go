@@ -0,0 +1,150 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"charm.land/log/v2"
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+// defaultMessages are the built-in English messages.
+var defaultMessages = config.Messages{
+	config.MessageUnknownServer:      "Unknown server: {{ .Address }}",
+	config.MessageNotWhitelisted:     "You are not whitelisted on this server",
+	config.MessageNotAuthenticated:   "Failed to verify username!",
+	config.MessageStarting:           "Server is being started, please try again later",
+	config.MessageStartTimeout:       "Server is taking too long to start, please try again later",
+	config.MessageStarted:            "Server has started, please reconnect",
+	config.MessageParked:             "Server is {{ .State }} ({{ .ProviderStatus }}){{ if .ETA }}, ready in about {{ .ETA }}{{ end }}",
+	config.MessageDraining:           "Server is going down for maintenance, please reconnect later",
+	config.MessageDrainKick:          "Server is going down for maintenance",
+	config.MessageRateLimited:        "You are connecting too often, please wait a moment",
+	config.MessageTooManyConnections: "Too many connections from your address",
+	config.MessageServerFull:         "Server is full, please try again later",
+	config.MessageFailed:             "Server failed to start, please contact an administrator",
+	config.MessageBlackout:           "Server is unavailable until {{ .AvailableAt.Format \"Mon 15:04 MST\" }}",
+}
+
+// messageVars are the variables available to message templates.
+type messageVars struct {
+	// Player is the name of the player, if known.
+	Player string
+
+	// Server is the hostname of the server, if known.
+	Server string
+
+	// Address is the hostname the client connected with.
+	Address string
+
+	// Captures contains the named captures of the regex route that
+	// matched Address, if any.
+	Captures map[string]string
+
+	// State is the lifecycle state of the server, e.g. "STARTING".
+	State string
+
+	// ProviderStatus is the status last reported by the server's cloud
+	// provider, e.g. "RUNNING".
+	ProviderStatus string
+
+	// ETA is the estimated time until the server is ready, based on how
+	// long it took to start last time. It's 0 if unknown.
+	ETA time.Duration
+
+	// DrainIn is the time until players are disconnected from a draining
+	// server. It's 0 if the server isn't draining.
+	DrainIn time.Duration
+
+	// AvailableAt is when the server's current blackout ends, in the
+	// schedule's time zone. It's the zero time outside of blackouts.
+	AvailableAt time.Time
+
+	// AvailableIn is the time until AvailableAt. It's 0 outside of
+	// blackouts.
+	AvailableIn time.Duration
+}
+
+// messageCatalog renders the messages sent to players.
+type messageCatalog struct {
+	// log is the logger used to report templates that fail to render.
+	log *log.Logger
+
+	// templates maps message keys to their templates.
+	templates map[string]*chatTemplate
+}
+
+// newMessageCatalog creates a message catalog from the provided layers
+// of messages. Messages in later layers override those in earlier ones.
+//
+//nolint:gocritic // Why: OK shadowing log.
+func newMessageCatalog(log *log.Logger, layers ...config.Messages) (*messageCatalog, error) {
+	merged := make(config.Messages)
+	for _, layer := range append([]config.Messages{defaultMessages}, layers...) {
+		for key, text := range layer {
+			if text != "" {
+				merged[key] = text
+			}
+		}
+	}
+
+	m := &messageCatalog{log: log, templates: make(map[string]*chatTemplate)}
+	for key, text := range merged {
+		tmpl, err := parseChatTemplate(key, text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s message", key)
+		}
+		m.templates[key] = tmpl
+	}
+
+	return m, nil
+}
+
+// render renders the message with the provided key. If the message
+// fails to render, its key is returned as plain text so the player gets
+// something rather than nothing.
+func (m *messageCatalog) render(key string, vars *messageVars) *minecraft.Chat {
+	msg, err := m.templates[key].render(vars)
+	if err != nil {
+		m.log.Warn("Failed to render message", "message", key, "err", err)
+		if msg == nil {
+			msg = &minecraft.Chat{Text: key}
+		}
+	}
+
+	return msg
+}
+
+// jsonEscaped implements chatVars.
+func (v *messageVars) jsonEscaped() chatVars {
+	escaped := *v
+	escaped.Player = jsonEscape(v.Player)
+	escaped.Server = jsonEscape(v.Server)
+	escaped.Address = jsonEscape(v.Address)
+	escaped.State = jsonEscape(v.State)
+	escaped.ProviderStatus = jsonEscape(v.ProviderStatus)
+	if v.Captures != nil {
+		escaped.Captures = make(map[string]string, len(v.Captures))
+		for name, value := range v.Captures {
+			escaped.Captures[name] = jsonEscape(value)
+		}
+	}
+
+	return &escaped
+}
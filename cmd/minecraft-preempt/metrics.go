@@ -0,0 +1,120 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"expvar"
+)
+
+// metrics contains the proxy's metrics. They're exposed through expvar
+// on the admin endpoint.
+var metrics = expvar.NewMap("proxy")
+
+// serverStates contains the state of each server, by hostname. It's
+// exposed through expvar on the admin endpoint.
+var serverStates = expvar.NewMap("server_states")
+
+// serverPreemptions contains the number of times each server was
+// preempted, by hostname, including before the proxy last restarted if
+// state is persisted. It's exposed through expvar on the admin endpoint.
+var serverPreemptions = expvar.NewMap("server_preemptions")
+
+// Contains the keys of all metrics in the metrics map.
+const (
+	// metricHandshakesPending is the number of connections currently
+	// waiting to send their handshake.
+	metricHandshakesPending = "handshakes_pending"
+
+	// metricHandshakesRejected is the number of connections dropped
+	// because too many connections were waiting to handshake.
+	metricHandshakesRejected = "handshakes_rejected_total"
+
+	// metricHandshakesTimedOut is the number of connections dropped
+	// because they didn't send a handshake in time.
+	metricHandshakesTimedOut = "handshakes_timed_out_total"
+
+	// metricHandshakesFailed is the number of connections dropped
+	// because they sent an invalid handshake.
+	metricHandshakesFailed = "handshakes_failed_total"
+
+	// metricLegacyPings is the number of legacy (pre-1.7) server list
+	// pings answered.
+	metricLegacyPings = "legacy_pings_total"
+
+	// metricConnectionsRateLimited is the number of connections dropped
+	// because their source made too many connections.
+	metricConnectionsRateLimited = "connections_rate_limited_total"
+
+	// metricStatusRateLimited is the number of status requests dropped
+	// because their source made too many status requests.
+	metricStatusRateLimited = "status_rate_limited_total"
+
+	// metricLoginsRateLimited is the number of login attempts rejected
+	// because their source made too many login attempts.
+	metricLoginsRateLimited = "logins_rate_limited_total"
+
+	// metricConnectionsPerIPRejected is the number of connections
+	// dropped because their IP had too many connections open.
+	metricConnectionsPerIPRejected = "connections_per_ip_rejected_total"
+
+	// metricServerFull is the number of login attempts rejected because
+	// the server had too many players.
+	metricServerFull = "server_full_total"
+
+	// metricStartTimeouts is the number of times a server didn't become
+	// ready within its start timeout.
+	metricStartTimeouts = "start_timeouts_total"
+
+	// metricStopTimeouts is the number of times a server didn't stop
+	// within its stop timeout.
+	metricStopTimeouts = "stop_timeouts_total"
+
+	// metricServersFailed is the number of times a server was marked
+	// failed after failing to start.
+	metricServersFailed = "servers_failed_total"
+
+	// metricPreemptions is the number of times a server stopped without
+	// the proxy stopping it.
+	metricPreemptions = "preemptions_total"
+)
+
+// publishState keeps the server's entry in serverStates up to date,
+// until the provided context is cancelled.
+func publishState(ctx context.Context, s *Server) {
+	transitions, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	set := func(state State) {
+		v := new(expvar.String)
+		v.Set(string(state))
+		serverStates.Set(s.config.Hostname, v)
+	}
+
+	serverPreemptions.Set(s.config.Hostname, expvar.Func(func() any {
+		return s.preemptions()
+	}))
+
+	set(s.State())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-transitions:
+			set(t.To)
+		}
+	}
+}
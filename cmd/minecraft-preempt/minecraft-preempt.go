@@ -31,6 +31,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/listenfd"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/version"
 )
 
@@ -75,7 +76,7 @@ func entrypoint(cmd *cobra.Command, _ []string) {
 		logger := log.With("server", sconf.Hostname)
 
 		logger.Info("Creating Server")
-		s, err := NewServer(logger, sconf)
+		s, err := NewServer(logger, conf, sconf)
 		if err != nil {
 			log.Error("failed to create server", "err", err)
 			return
@@ -83,12 +84,38 @@ func entrypoint(cmd *cobra.Command, _ []string) {
 		servers[i] = s
 	}
 
+	// use listeners passed by systemd, or the process we're taking over
+	// from, if any
+	inherited, err := listenfd.Inherit()
+	if err != nil {
+		log.Error("failed to inherit listeners", "err", err)
+		return
+	}
+
 	finisedChan := make(chan struct{})
-	p := NewProxy(log, conf.ListenAddress, servers)
+	p, err := NewProxy(log, conf, servers, inherited)
+	if err != nil {
+		log.Error("failed to create proxy", "err", err)
+		return
+	}
+
+	// SIGUSR2 hands our listeners off to a new process, e.g. after the
+	// binary or config was updated.
+	handoff := make(chan os.Signal, 1)
+	signal.Notify(handoff, syscall.SIGUSR2)
+	defer signal.Stop(handoff)
+
+	proxyCtx, cancelProxy := context.WithCancel(ctx)
+	defer cancelProxy()
+
+	// connections have their own context, so that they keep being served
+	// after the listeners are handed off to a new process.
+	connCtx, cancelConns := context.WithCancel(context.Background())
+	defer cancelConns()
 
 	// start the proxy in a goroutine so we can wait for it to exit later.
 	go func() {
-		if err := p.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		if err := p.Start(proxyCtx, connCtx); err != nil && !errors.Is(err, context.Canceled) {
 			log.Error("proxy exited", "err", err)
 		}
 		log.Info("Proxy exited")
@@ -96,19 +123,51 @@ func entrypoint(cmd *cobra.Command, _ []string) {
 		close(finisedChan)
 	}()
 
-	// wait for the context to be cancelled
-	<-ctx.Done()
+	// wait for the context to be cancelled, or for a new process to take
+	// over
+	handedOff := false
+	for !handedOff && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-handoff:
+			log.Info("Handing off listeners to a new process")
+			if err := p.Handoff(); err != nil {
+				log.Error("failed to hand off listeners", "err", err)
+				continue
+			}
+			handedOff = true
+		}
+	}
+	cancelProxy()
+
+	if handedOff {
+		// The new process accepts new connections, keep serving the
+		// existing ones until they end or we're told to stop.
+		log.Info("Listeners handed off, waiting for connections to end")
+		p.Wait(ctx)
+
+		// The new process manages the servers now, so they're neither
+		// drained nor stopped, which would also affect its players.
+		log.Info("Shutting down")
+		cancelConns()
+		<-finisedChan
+
+		log.Info("Shutdown complete")
+		return
+	}
 	log.Info("Shutting down")
 
-	// create a new context with a 15 second timeout
+	// create a new context with enough time to drain the servers, plus
+	// 15 seconds to kick the remaining players
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), conf.Drain.Timeout+15*time.Second)
 	defer cancel()
 
 	// stop the proxy
 	if err := p.Stop(ctx); err != nil {
 		log.Warn("failed to stop proxy", "err", err)
 	}
+	cancelConns()
 	<-finisedChan
 
 	log.Info("Shutdown complete")
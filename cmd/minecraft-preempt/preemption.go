@@ -0,0 +1,63 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+)
+
+// eventPreempted is the history event of a server that stopped without
+// the proxy stopping it.
+const eventPreempted = "preempted"
+
+// preempted handles the server stopping without the proxy stopping it,
+// e.g. because its spot instance was preempted or its container exited,
+// while it was in the provided state. The preemption is recorded and, if
+// configured, the server is restarted once it has stopped.
+func (s *Server) preempted(from State) {
+	players := s.connections.Load()
+	s.log.Warn("Server stopped unexpectedly, it was likely preempted", "state", from, "connections", players)
+	metrics.Add(metricPreemptions, 1)
+	s.recordEvent(HistoryEvent{At: time.Now(), Event: eventPreempted, State: from, Players: players})
+
+	// Don't count the time before the preemption towards stopping the
+	// server for being empty once it's back.
+	s.emptySince.Store(nil)
+
+	if !s.config.Preemption.Restart {
+		return
+	}
+
+	// The restart is picked up by checkTimeouts once the server has
+	// stopped, failed attempts are retried using the preemption policy.
+	s.recovering.Store(true)
+	s.startFailures.Store(0)
+	now := time.Now()
+	s.retryAt.Store(&now)
+}
+
+// retryConfig returns the policy for retrying failed starts. While the
+// server is being restarted after a preemption, that's the preemption
+// policy.
+func (s *Server) retryConfig() *config.RetryConfig {
+	if s.recovering.Load() {
+		return &s.config.Preemption.Retry
+	}
+
+	return &s.config.Retry
+}
@@ -17,46 +17,101 @@ package main
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
+	"os"
+	"sync"
 	"time"
 
 	"charm.land/log/v2"
 	mcnet "github.com/Tnze/go-mc/net"
 	"github.com/pkg/errors"
-	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/listenfd"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/proxyproto"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/ratelimit"
 )
 
 // Proxy is a proxy server
 type Proxy struct {
-	*mcnet.Listener
+	// listeners are the listeners the proxy accepts connections on.
+	listeners []*listener
+
+	// adminListener is the listener the admin endpoint is served on, if
+	// enabled.
+	adminListener net.Listener
+
+	// inherited contains the listeners passed to the process, which are
+	// used instead of creating new ones.
+	inherited *listenfd.Set
 
 	// log is our proxy's logger
 	log *log.Logger
 
-	// listenAddress is the address to listen on (the proxy)
-	listenAddress string
+	// config is our proxy's configuration
+	config *config.ProxyConfig
+
+	// servers contains all of the servers we proxy to.
+	servers []*Server
+
+	// router routes client hostnames to servers.
+	router *Router
 
-	// servers is a map of server hostnames to their server information.
-	servers map[string]*Server
+	// messages contains the messages sent to clients that don't route
+	// to a server.
+	messages *messageCatalog
+
+	// connectionLimit, statusLimit and loginLimit limit the rate of new
+	// connections, status requests and login attempts per source IP.
+	connectionLimit *ratelimit.Limiter
+	statusLimit     *ratelimit.Limiter
+	loginLimit      *ratelimit.Limiter
+
+	// perIP limits the number of concurrent connections per source IP.
+	perIP *ratelimit.Counter
 }
 
-// NewProxy creates a new proxy
+// NewProxy creates a new proxy. Listeners in inherited are used instead
+// of creating new ones.
 //
 //nolint:gocritic // Why: OK shadowing log.
-func NewProxy(log *log.Logger, listenAddress string, s []*Server) *Proxy {
-	servers := make(map[string]*Server)
-	for _, server := range s {
-		servers[server.config.Hostname] = server
+func NewProxy(log *log.Logger, conf *config.ProxyConfig, servers []*Server, inherited *listenfd.Set) (*Proxy, error) {
+	router, err := NewRouter(servers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create router")
 	}
 
-	return &Proxy{
-		log:           log,
-		listenAddress: listenAddress,
-		servers:       servers,
+	messages, err := newMessageCatalog(log, conf.Messages[conf.Language])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid messages")
 	}
+
+	for _, r := range router.Routes() {
+		log.Info("Route", "hostname", r.Pattern, "server", r.Server, "ports", r.Ports)
+	}
+
+	return &Proxy{
+		log:       log,
+		config:    conf,
+		servers:   servers,
+		router:    router,
+		messages:  messages,
+		inherited: inherited,
+
+		connectionLimit: newLimiter(&conf.RateLimit.Connections),
+		statusLimit:     newLimiter(&conf.RateLimit.Status),
+		loginLimit:      newLimiter(&conf.RateLimit.Login),
+		perIP:           ratelimit.NewCounter(conf.RateLimit.MaxConnectionsPerIP),
+	}, nil
+}
+
+// newLimiter creates a rate limiter from its configuration.
+func newLimiter(conf *config.RateLimit) *ratelimit.Limiter {
+	return ratelimit.New(conf.Rate, conf.Burst, conf.NetworkRate, conf.NetworkBurst)
 }
 
 // watcher is a status reporter for a proxy and stopper for a server
@@ -71,21 +126,65 @@ func (p *Proxy) watcher(ctx context.Context) error {
 
 		// for each server, check the status. Shutdown if we're empty longer
 		// than our configured time.
-		for serverAddress, server := range p.servers {
+		for _, server := range p.servers {
 			//nolint:gocritic // Why: OK shadowing log.
-			log := p.log.With("server", serverAddress)
+			log := p.log.With("server", server.config.Hostname)
+
+			state, err := server.Sync(ctx)
+			if err != nil {
+				log.Error("failed to get server status", "err", err)
+				continue
+			}
+
+			server.checkTimeouts(ctx)
+			if !state.running() {
+				if until, ok := server.schedule.prewarmUntil(time.Now()); ok && state == StateStopped {
+					log.Info("Prewarming server for schedule", "until", until)
+					if err := server.Start(ctx); err != nil {
+						log.Error("failed to start server", "err", err)
+					}
+				}
+				continue
+			}
+
+			// probe the server so it becomes ready without waiting for a
+			// player to show up, and to see how many players it has.
+			mcStatus, ready, err := server.Probe()
+			if !ready {
+				// Servers are only stopped once they're ready, so that
+				// they're never stopped mid-boot.
+				log.Info("Server is warming up", "err", err)
+				server.emptySince.Store(nil)
+				continue
+			}
+
+			// stop the server when a blackout begins, if configured
+			if until, ok := server.schedule.blackoutUntil(time.Now()); ok && server.config.Schedule.Blackout.Stop {
+				log.Info("Proxy status", "connections", server.connections.Load(), "blackout_until", until)
+				server.emptySince.Store(nil)
+				go server.stopForBlackout(ctx)
+				continue
+			}
+
+			// don't stop the server while the schedule keeps it alive
+			if until, ok := server.schedule.keepAliveUntil(time.Now()); ok {
+				log.Info("Proxy status", "connections", server.connections.Load(), "kept_alive_until", until)
+				server.emptySince.Store(nil)
+				continue
+			}
+
 			// if we have connections, don't try to stop the server
 			if server.connections.Load() != 0 {
 				log.Info("Proxy status", "connections", server.connections.Load())
 				continue
 			}
 
-			status, err := server.GetStatus(ctx)
-			if err != nil {
-				log.Error("failed to get server status", "err", err)
-				continue
-			}
-			if status != cloud.StatusRunning {
+			// players may be connected through another process, e.g. the
+			// one we took over from, so don't stop the server while the
+			// server itself reports players online.
+			if mcStatus != nil && mcStatus.Players != nil && mcStatus.Players.Online > 0 {
+				log.Info("Proxy status", "connections", 0, "players", mcStatus.Players.Online)
+				server.emptySince.Store(nil)
 				continue
 			}
 
@@ -117,109 +216,315 @@ func (p *Proxy) watcher(ctx context.Context) error {
 	return ctx.Err()
 }
 
-// Start starts the proxy to the server, this is a blocking call
-func (p *Proxy) Start(ctx context.Context) error {
-	l, err := minecraft.ListenMC(p.listenAddress)
+// listener is a listener the proxy accepts connections on.
+type listener struct {
+	*mcnet.Listener
+
+	// address is the configured address of the listener.
+	address string
+
+	// tcp is the underlying TCP listener, which is handed off to new
+	// processes.
+	tcp net.Listener
+
+	// port is the port the listener is bound to, used for routing.
+	port int
+}
+
+// listen creates a listener for the provided configuration. If enabled,
+// the PROXY protocol is accepted from trusted sources.
+func (p *Proxy) listen(conf *config.ListenerConfig) (*listener, error) {
+	l, err := p.inherited.Listen(conf.Address)
 	if err != nil {
-		return errors.Wrap(err, "failed to listen on address")
+		return nil, errors.Wrapf(err, "failed to listen on address %q", conf.Address)
+	}
+	tcp := l
+
+	// Use the bound port rather than the configured one, which may be 0.
+	// TCP listeners always have a TCP address.
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if pp := conf.ProxyProtocol; pp.Enabled {
+		trusted, err := pp.TrustedNetworks()
+		if err != nil {
+			l.Close()
+			return nil, errors.Wrap(err, "failed to parse trusted networks")
+		}
+
+		p.log.Info("Accepting PROXY protocol", "address", conf.Address, "trusted", pp.TrustedCIDRs)
+		l = &proxyproto.Listener{Listener: l, Trusted: trusted}
+	}
+
+	return &listener{Listener: minecraft.NewListener(l), address: conf.Address, tcp: tcp, port: port}, nil
+}
+
+// Start starts the proxy to the server, this is a blocking call.
+// Connections are handled with connCtx rather than ctx, so that they
+// aren't interrupted when the proxy stops accepting new ones.
+func (p *Proxy) Start(ctx, connCtx context.Context) error {
+	for i := range p.config.Listeners {
+		l, err := p.listen(&p.config.Listeners[i])
+		if err != nil {
+			p.closeListeners()
+			return err
+		}
+		p.listeners = append(p.listeners, l)
+	}
+
+	if p.config.AdminAddress != "" {
+		l, err := p.inherited.Listen(p.config.AdminAddress)
+		if err != nil {
+			p.closeListeners()
+			return errors.Wrapf(err, "failed to listen on admin address %q", p.config.AdminAddress)
+		}
+		p.adminListener = l
+	}
+
+	// Inherited listeners that are no longer configured aren't needed.
+	p.inherited.Close() //nolint:errcheck // Why: Best effort.
+	if err := p.inherited.Ready(); err != nil {
+		p.log.Warn("Failed to report readiness", "err", err)
 	}
-	p.Listener = l
 
 	errChan := make(chan error)
 
+	for _, server := range p.servers {
+		go publishState(ctx, server)
+	}
+
 	// start the watcher
 	go func() {
 		if err := p.watcher(ctx); err != nil {
 			p.log.Error("proxy server watcher encountered unrecoverable error", "err", err)
 
-			// signal to the main go-routine that the proxy has shut down.
-			errChan <- err
+			// signal to the main go-routine that the proxy has shut down,
+			// unless it already has.
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
 		}
 	}()
 
-	connChan := make(chan *mcnet.Conn)
-	go func() {
-		for {
-			conn, err := p.accept()
-			if err != nil {
-				p.log.Error("failed to accept connection", "err", err)
-			} else {
-				connChan <- conn
+	// start the admin endpoint
+	if p.adminListener != nil {
+		go func() {
+			if err := p.serveAdmin(ctx); err != nil {
+				p.log.Error("admin endpoint exited", "err", err)
 			}
+		}()
+	}
 
-			if ctx.Err() != nil {
-				// We've probably already exited out of the main go-routine by now, but just incase we
-				// should communicate back.
-				errChan <- ctx.Err()
-			}
-		}
-	}()
+	connChan := make(chan *acceptedConn)
+	for _, l := range p.listeners {
+		go p.acceptConnections(ctx, l, connChan)
+
+		p.log.Info("Proxy started", "address", l.address)
+	}
+
+	// pending limits the number of connections waiting to handshake at
+	// once.
+	pending := make(chan struct{}, p.config.MaxPendingHandshakes)
 
-	p.log.Info("Proxy started", "address", p.listenAddress)
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case err := <-errChan:
 			return err
 		case conn := <-connChan:
-			if err := p.handleConnection(ctx, conn); err != nil {
-				p.log.Error("failed to handle connection", "err", err)
+			select {
+			case pending <- struct{}{}:
+			default:
+				// Note: RemoteAddr isn't logged here since it may block
+				// reading a PROXY protocol header.
+				p.log.Warn("Too many pending handshakes, dropping connection")
+				metrics.Add(metricHandshakesRejected, 1)
+				conn.Close()
+				continue
 			}
+
+			// handshake in a goroutine so that slow clients don't block
+			// other clients from connecting.
+			metrics.Add(metricHandshakesPending, 1)
+			go func() {
+				defer func() {
+					metrics.Add(metricHandshakesPending, -1)
+					<-pending
+				}()
+
+				if err := p.handleConnection(connCtx, conn.Conn, conn.port); err != nil {
+					p.log.Error("failed to handle connection", "err", err)
+				}
+			}()
+		}
+	}
+}
+
+// acceptConnections accepts connections on the provided listener,
+// sending them to connChan, until the listener is closed or the context
+// is cancelled.
+func (p *Proxy) acceptConnections(ctx context.Context, l *listener, connChan chan<- *acceptedConn) {
+	for {
+		conn, err := p.accept(l)
+		if conn == nil && err == nil {
+			// The listener was closed, we're shutting down.
+			return
+		}
+
+		if err != nil {
+			p.log.Error("failed to accept connection", "address", l.address, "err", err)
+			continue
+		}
+
+		// Start stops receiving once the context is cancelled, which may
+		// be before the listener is closed.
+		select {
+		case connChan <- &acceptedConn{conn, l.port}:
+		case <-ctx.Done():
+			conn.Close()
+			return
 		}
 	}
 }
 
-func (p *Proxy) handleConnection(ctx context.Context, rawConn *mcnet.Conn) error {
+// acceptedConn is a connection accepted by one of the proxy's
+// listeners.
+type acceptedConn struct {
+	*mcnet.Conn
+
+	// port is the port of the listener that accepted the connection.
+	port int
+}
+
+// handleConnection reads the handshake from a newly accepted connection
+// and starts proxying it to the server it's for. listenPort is the port
+// of the listener that accepted the connection.
+func (p *Proxy) handleConnection(ctx context.Context, rawConn *mcnet.Conn, listenPort int) error {
 	minecraftConn := &minecraft.Client{
 		Conn: rawConn,
 	}
 
+	// Bound how long the client has to send its handshake.
+	if err := rawConn.Socket.SetReadDeadline(time.Now().Add(p.config.HandshakeTimeout)); err != nil {
+		rawConn.Close()
+		return errors.Wrap(err, "failed to set handshake deadline")
+	}
+
 	//nolint:gocritic // Why: OK shadowing log.
 	log := p.log.With("client", rawConn.Socket.RemoteAddr())
-	h, err := minecraftConn.Handshake()
+
+	// Count the connection towards its IP's limit for its entire
+	// lifetime, which is handed off to the proxying go-routine.
+	ip := ratelimit.SourceIP(rawConn.Socket.RemoteAddr())
+	acquired := p.perIP.Acquire(ip)
+	handedOff := false
+	defer func() {
+		if acquired && !handedOff {
+			p.perIP.Release(ip)
+		}
+	}()
+
+	// Clients older than 1.7 start with a legacy ping instead of a
+	// handshake.
+	var h *minecraft.Handshake
+	ping, err := minecraftConn.ReadLegacyPing()
+	if err == nil && ping == nil {
+		h, err = minecraftConn.Handshake()
+	}
 	if err != nil {
+		rawConn.Close()
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			log.Debug("Client did not send handshake in time")
+			metrics.Add(metricHandshakesTimedOut, 1)
+			return nil
+		}
+
 		// don't log EOF
 		if !errors.Is(err, io.EOF) {
+			metrics.Add(metricHandshakesFailed, 1)
 			return errors.Wrap(err, "failed to handshake")
 		}
 		return nil
 	}
 
-	// Determine the server from the handshake's address.
-	server, ok := p.servers[h.ServerAddress]
+	state := minecraft.ClientStateCheck
+	if h != nil {
+		state = minecraft.ClientState(h.NextState)
+	}
+	if message, metric := p.checkLimits(ip, acquired, state); metric != "" {
+		defer rawConn.Close()
+
+		log.Debug("Connection rejected by limits", "reason", metric)
+		metrics.Add(metric, 1)
+
+		// Status requests don't have a way to tell the client why.
+		if message == "" {
+			return nil
+		}
+		return minecraftConn.SendDisconnect(p.messages.render(message, &messageVars{Address: h.ServerAddress}))
+	}
+
+	if ping != nil {
+		return p.handleLegacyPing(ctx, log, minecraftConn, ping, listenPort)
+	}
+
+	if err := rawConn.Socket.SetReadDeadline(time.Time{}); err != nil {
+		rawConn.Close()
+		return errors.Wrap(err, "failed to clear handshake deadline")
+	}
+
+	// Determine the server from the handshake's address and the port
+	// the client connected to.
+	match, ok := p.router.Route(h.ServerAddress, h.ServerPort, listenPort)
 	if !ok {
-		log.Warn("Unknown server", "server", h.ServerAddress)
-		return minecraftConn.SendDisconnect(fmt.Sprintf("Unknown server: %s", h.ServerAddress))
+		log.Warn("Unknown server", "server", h.ServerAddress, "port", h.ServerPort, "listen_port", listenPort)
+		return minecraftConn.SendDisconnect(p.messages.render(config.MessageUnknownServer, &messageVars{
+			Address: h.ServerAddress,
+		}))
 	}
+	server := match.Server
 	log = log.With("server", server.config.Hostname)
+	log.Debug("Routed connection", "hostname", h.ServerAddress, "route", match.Pattern, "captures", match.Captures)
 
 	// tracks if this connection made it to the login state
 	// HACK(jaredallard): We should do something better than this.
 	var madeItToLogin bool
+	var username string
 
 	// create a new connection
-	conn := NewConnection(minecraftConn, log, server, h, &ConnectionHooks{
+	conn := NewConnection(minecraftConn, log, server, h, match.Captures, &ConnectionHooks{
 		OnLogin: func(l *minecraft.LoginStart) {
-			log.Info("Login initiated", "username", l.Name)
+			log.Info("Login initiated", "username", l.Name, "uuid", l.UUID)
 			// track that we made it to login state for connection
 			// tracking
 			madeItToLogin = true
+			username = l.Name
 
-			// reset the emptySince time
+			// reset the emptySince time, the connection was already
+			// counted by checkLogin.
 			server.emptySince.Store(nil)
-			server.connections.Add(1)
+			server.SawPlayer(l.Name)
 		},
 		OnClose: func() {
 			// only decrement if we made it to login state, where we
 			// would've incremented the connection count
 			if madeItToLogin {
 				server.connections.Add(^uint64(0))
+				server.SawPlayer(username)
 			}
 		},
 	})
 	connAddr := rawConn.Socket.RemoteAddr().String()
 
 	// proxy the connection in a goroutine
+	handedOff = true
 	go func() {
+		if acquired {
+			defer p.perIP.Release(ip)
+		}
+
 		p.log.Debug("Handling connection", "addr", connAddr)
 		if err := conn.Proxy(ctx); err != nil {
 			p.log.Error("failed to proxy connection", "err", err)
@@ -232,10 +537,60 @@ func (p *Proxy) handleConnection(ctx context.Context, rawConn *mcnet.Conn) error
 	return nil
 }
 
-// accept accepts a connection on the proxy listener.
-func (p *Proxy) accept() (*mcnet.Conn, error) {
+// checkLimits checks a connection from the provided IP, in the provided
+// state, against the configured limits. acquired is whether or not the
+// connection is within the IP's concurrent connection limit. If the
+// connection is rejected, the metric to count it with is returned, along
+// with the key of the message to disconnect the player with, if any.
+func (p *Proxy) checkLimits(ip netip.Addr, acquired bool, state minecraft.ClientState) (message, metric string) {
+	isLogin := state == minecraft.ClientStatePlayerLogin || state == minecraft.ClientStateTransfer
+	loginMessage := func(key string) string {
+		if isLogin {
+			return key
+		}
+		return ""
+	}
+
+	switch {
+	case !acquired:
+		return loginMessage(config.MessageTooManyConnections), metricConnectionsPerIPRejected
+	case !p.connectionLimit.Allow(ip):
+		return loginMessage(config.MessageRateLimited), metricConnectionsRateLimited
+	case isLogin && !p.loginLimit.Allow(ip):
+		return config.MessageRateLimited, metricLoginsRateLimited
+	case state == minecraft.ClientStateCheck && !p.statusLimit.Allow(ip):
+		return "", metricStatusRateLimited
+	}
+
+	return "", ""
+}
+
+// handleLegacyPing answers a legacy server list ping with the status of
+// the server it routes to. Only 1.6 clients send the hostname they're
+// pinging, older clients are routed to the default server.
+//
+//nolint:gocritic // Why: OK shadowing log.
+func (p *Proxy) handleLegacyPing(ctx context.Context, log *log.Logger, mc *minecraft.Client,
+	ping *minecraft.LegacyPing, listenPort int) error {
+	defer mc.Close()
+	metrics.Add(metricLegacyPings, 1)
+
+	match, ok := p.router.Route(ping.ServerAddress, ping.ServerPort, listenPort)
+	if !ok {
+		log.Debug("No server for legacy ping", "server", ping.ServerAddress, "listen_port", listenPort)
+		return nil
+	}
+	log = log.With("server", match.Server.config.Hostname)
+	log.Debug("Answering legacy ping", "beta", ping.Beta, "route", match.Pattern)
+
+	conn := NewConnection(mc, log, match.Server, nil, match.Captures, &ConnectionHooks{})
+	return conn.legacyStatus(ctx, ping)
+}
+
+// accept accepts a connection on the provided listener.
+func (p *Proxy) accept(l *listener) (*mcnet.Conn, error) {
 	// TODO(george-e-shaw-iv): Someone needs to go and make the underlying library respect context with net.ListenConfig.
-	rawConn, err := p.Accept()
+	rawConn, err := l.Accept()
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return nil, err // Context cancellation is a real error.
@@ -249,28 +604,73 @@ func (p *Proxy) accept() (*mcnet.Conn, error) {
 	return &rawConn, nil
 }
 
-// Stop stops the server
+// closeListeners closes all of the proxy's listeners.
+func (p *Proxy) closeListeners() error {
+	var errs []error
+	for _, l := range p.listeners {
+		// Listeners are already closed if they were handed off.
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// Handoff starts a new process, see listenfd.Handoff, passing it the
+// proxy's listeners. Once the new process is ready, the proxy stops
+// accepting connections. Existing connections are unaffected.
+func (p *Proxy) Handoff() error {
+	listeners := make([]net.Listener, 0, len(p.listeners)+1)
+	for _, l := range p.listeners {
+		listeners = append(listeners, l.tcp)
+	}
+	if p.adminListener != nil {
+		listeners = append(listeners, p.adminListener)
+	}
+
+	process, err := listenfd.Handoff(listeners)
+	if err != nil {
+		return err
+	}
+	p.log.Info("New process is ready, no longer accepting connections", "pid", process.Pid)
+
+	return p.closeListeners()
+}
+
+// Wait blocks until all servers have no connections, or the context is
+// done.
+func (p *Proxy) Wait(ctx context.Context) {
+	for _, server := range p.servers {
+		if err := server.waitForEmpty(ctx); err != nil {
+			return
+		}
+	}
+}
+
+// Stop stops accepting connections and drains all servers, see
+// Server.Drain. Players still online once the configured drain timeout,
+// or the context, expires are disconnected.
 func (p *Proxy) Stop(ctx context.Context) error {
-	if p.Listener != nil {
-		return p.Close()
+	if err := p.closeListeners(); err != nil {
+		p.log.Warn("Failed to close listeners", "err", err)
 	}
 
-	// wait for all connections to drain
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
 	for _, server := range p.servers {
-		connections := server.connections.Load()
-		if connections > 0 {
-			p.log.Info("Waiting for connections to drain during shutdown", "server", server.config.Hostname, "connections", connections)
-
-			for server.connections.Load() != 0 {
-				// wait before checking again, but also break if the context is cancelled
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.After(100 * time.Millisecond):
-				}
+		wg.Go(func() {
+			if err := server.Drain(ctx, p.config.Drain.Timeout); err != nil {
+				mu.Lock()
+				errs = append(errs, errors.Wrapf(err, "failed to drain server %q", server.config.Hostname))
+				mu.Unlock()
 			}
-		}
+		})
 	}
+	wg.Wait()
 
-	return nil
+	return stderrors.Join(errs...)
 }
@@ -0,0 +1,296 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// route is a hostname pattern that routes to a server.
+type route struct {
+	// pattern is the pattern as written in the configuration.
+	pattern string
+
+	// suffix is the suffix matched by a wildcard route, including the
+	// leading dot.
+	suffix string
+
+	// re is the regular expression matched by a regex route.
+	re *regexp.Regexp
+
+	// server is the server the route routes to.
+	server *Server
+}
+
+// RouteMatch is the result of routing a hostname to a server.
+type RouteMatch struct {
+	// Server is the server the hostname was routed to.
+	Server *Server
+
+	// Pattern is the pattern that matched the hostname.
+	Pattern string
+
+	// Captures contains the named captures of a regex route.
+	Captures map[string]string
+}
+
+// RouteInfo describes a route, for display purposes.
+type RouteInfo struct {
+	// Pattern is the pattern that is matched.
+	Pattern string
+
+	// Server is the hostname of the server the route routes to.
+	Server string
+
+	// Ports are the listener ports the route is restricted to, if any.
+	Ports []int
+}
+
+// Router routes connections to servers based on the hostname and port
+// the client connected with, and the port of the listener that accepted
+// the connection. Hostnames are normalized before matching by
+// lowercasing them and removing any trailing dot.
+//
+// Only servers that are available on the accepting listener's port are
+// considered. Of those, routes are matched in the following order:
+//
+//  1. exact hostnames with a port
+//  2. exact hostnames
+//  3. wildcard hostnames, most specific (longest) first
+//  4. regular expressions, in configuration order
+//  5. the default server for the listener's port
+//  6. the default server for all ports
+type Router struct {
+	exact     map[string][]*route
+	wildcards []*route
+	regexes   []*route
+
+	// defaults maps listener ports to their default server, with 0
+	// being the default server for all ports.
+	defaults map[int]*Server
+}
+
+// NewRouter creates a router for the provided servers.
+func NewRouter(servers []*Server) (*Router, error) {
+	r := &Router{
+		exact:    make(map[string][]*route),
+		defaults: make(map[int]*Server),
+	}
+	for _, s := range servers {
+		if s.config.Default {
+			ports := s.config.Ports
+			if len(ports) == 0 {
+				ports = []int{0}
+			}
+
+			for _, port := range ports {
+				if existing, ok := r.defaults[port]; ok {
+					return nil, fmt.Errorf("server %q and %q are both the default server",
+						existing.config.Hostname, s.config.Hostname)
+				}
+				r.defaults[port] = s
+			}
+		}
+
+		for _, pattern := range append([]string{s.config.Hostname}, s.config.Hostnames...) {
+			if err := r.add(pattern, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Longer suffixes are more specific.
+	sort.SliceStable(r.wildcards, func(i, j int) bool {
+		return len(r.wildcards[i].suffix) > len(r.wildcards[j].suffix)
+	})
+
+	return r, nil
+}
+
+// add adds a route for the provided pattern.
+func (r *Router) add(pattern string, s *Server) error {
+	rt := &route{pattern: pattern, server: s}
+	switch {
+	case strings.HasPrefix(pattern, "~"):
+		// Patterns must match the whole hostname, so that e.g.
+		// "mc\.example\.com" doesn't match "mc.example.com.example.net".
+		re, err := regexp.Compile("(?i)^(?:" + pattern[1:] + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid hostname pattern %q: %w", pattern, err)
+		}
+		rt.re = re
+		r.regexes = append(r.regexes, rt)
+	case strings.HasPrefix(pattern, "*."):
+		rt.suffix = normalizeHostname(pattern[1:])
+		r.wildcards = append(r.wildcards, rt)
+	default:
+		key := exactKey(pattern)
+		for _, existing := range r.exact[key] {
+			if existing.server != s && portsOverlap(existing.server, s) {
+				return fmt.Errorf("hostname %q is used by both %q and %q",
+					key, existing.server.config.Hostname, s.config.Hostname)
+			}
+		}
+		r.exact[key] = append(r.exact[key], rt)
+	}
+
+	return nil
+}
+
+// Route returns the server the provided hostname and port, as sent by
+// the client, routes to for a connection accepted on listenPort. False
+// is returned if no server matched and there is no default server.
+func (r *Router) Route(hostname string, port uint16, listenPort int) (*RouteMatch, bool) {
+	hostname = normalizeHostname(hostname)
+
+	for _, key := range []string{net.JoinHostPort(hostname, strconv.Itoa(int(port))), hostname} {
+		for _, rt := range r.exact[key] {
+			if servesPort(rt.server, listenPort) {
+				return &RouteMatch{Server: rt.server, Pattern: rt.pattern}, true
+			}
+		}
+	}
+
+	for _, rt := range r.wildcards {
+		if strings.HasSuffix(hostname, rt.suffix) && servesPort(rt.server, listenPort) {
+			return &RouteMatch{Server: rt.server, Pattern: rt.pattern}, true
+		}
+	}
+
+	for _, rt := range r.regexes {
+		if !servesPort(rt.server, listenPort) {
+			continue
+		}
+
+		m := rt.re.FindStringSubmatch(hostname)
+		if m == nil {
+			continue
+		}
+
+		captures := make(map[string]string)
+		for i, name := range rt.re.SubexpNames() {
+			if name != "" {
+				captures[name] = m[i]
+			}
+		}
+		return &RouteMatch{Server: rt.server, Pattern: rt.pattern, Captures: captures}, true
+	}
+
+	if s, ok := r.defaults[listenPort]; ok {
+		return &RouteMatch{Server: s, Pattern: "default"}, true
+	}
+	if s, ok := r.defaults[0]; ok {
+		return &RouteMatch{Server: s, Pattern: "default"}, true
+	}
+
+	return nil, false
+}
+
+// Routes returns all routes in the order they're matched.
+func (r *Router) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(r.exact)+len(r.wildcards)+len(r.regexes)+len(r.defaults))
+
+	// Exact hostnames with a port are matched first, put them first.
+	keys := make([]string, 0, len(r.exact))
+	for key := range r.exact {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		_, _, iErr := net.SplitHostPort(keys[i])
+		_, _, jErr := net.SplitHostPort(keys[j])
+		if (iErr == nil) != (jErr == nil) {
+			return iErr == nil
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		for _, rt := range r.exact[key] {
+			routes = append(routes, RouteInfo{key, rt.server.config.Hostname, rt.server.config.Ports})
+		}
+	}
+	for _, rt := range r.wildcards {
+		routes = append(routes, RouteInfo{rt.pattern, rt.server.config.Hostname, rt.server.config.Ports})
+	}
+	for _, rt := range r.regexes {
+		routes = append(routes, RouteInfo{rt.pattern, rt.server.config.Hostname, rt.server.config.Ports})
+	}
+
+	ports := make([]int, 0, len(r.defaults))
+	for port := range r.defaults {
+		ports = append(ports, port)
+	}
+	// Port specific defaults are matched before the default for all
+	// ports (0).
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[j] == 0 || (ports[i] != 0 && ports[i] < ports[j])
+	})
+
+	for _, port := range ports {
+		info := RouteInfo{Pattern: "default", Server: r.defaults[port].config.Hostname}
+		if port != 0 {
+			info.Ports = []int{port}
+		}
+		routes = append(routes, info)
+	}
+
+	return routes
+}
+
+// normalizeHostname lowercases the provided hostname and removes any
+// trailing dot.
+func normalizeHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(hostname), ".")
+}
+
+// exactKey returns the key an exact hostname pattern, optionally with a
+// port, is stored under.
+func exactKey(pattern string) string {
+	host, port, err := net.SplitHostPort(pattern)
+	if err != nil {
+		return normalizeHostname(pattern)
+	}
+
+	return net.JoinHostPort(normalizeHostname(host), port)
+}
+
+// servesPort returns true if the provided server is available on
+// listeners with the provided port.
+func servesPort(s *Server, port int) bool {
+	return len(s.config.Ports) == 0 || slices.Contains(s.config.Ports, port)
+}
+
+// portsOverlap returns true if the provided servers are available on
+// at least one of the same listener ports.
+func portsOverlap(a, b *Server) bool {
+	if len(a.config.Ports) == 0 || len(b.config.Ports) == 0 {
+		return true
+	}
+
+	for _, port := range a.config.Ports {
+		if slices.Contains(b.config.Ports, port) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+)
+
+// newTestServer returns a server with the provided configuration, for
+// routing.
+func newTestServer(conf config.ServerConfig) *Server {
+	return &Server{config: &conf}
+}
+
+func TestRouterRoute(t *testing.T) {
+	exact := newTestServer(config.ServerConfig{Hostname: "mc.example.com"})
+	exactPort := newTestServer(config.ServerConfig{Hostname: "other.example.com", Hostnames: []string{"mc.example.com:25566"}})
+	wildcard := newTestServer(config.ServerConfig{Hostname: "*.example.com"})
+	specific := newTestServer(config.ServerConfig{Hostname: "*.survival.example.com"})
+	regex := newTestServer(config.ServerConfig{
+		Hostname:  "regex.example.net",
+		Hostnames: []string{`~^(?P<world>[a-z]+)\.worlds\.example\.net$`},
+	})
+	firstRegex := newTestServer(config.ServerConfig{Hostname: `~first\..*`, Hostnames: []string{`~.*\.example\.net`}})
+	unanchored := newTestServer(config.ServerConfig{Hostname: `~mc\.example\.org`})
+	portOnly := newTestServer(config.ServerConfig{Hostname: "creative.example.org", Ports: []int{25570}})
+	portDefault := newTestServer(config.ServerConfig{Hostname: "lobby.example.org", Default: true, Ports: []int{25570}})
+	globalDefault := newTestServer(config.ServerConfig{Hostname: "fallback.example.org", Default: true})
+
+	r, err := NewRouter([]*Server{
+		exact, exactPort, wildcard, specific, regex, firstRegex, unanchored, portOnly, portDefault, globalDefault,
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		hostname     string
+		port         uint16
+		listenPort   int
+		want         *Server
+		wantPattern  string
+		wantCaptures map[string]string
+	}{
+		{
+			name: "exact", hostname: "mc.example.com", port: 25565, listenPort: 25565,
+			want: exact, wantPattern: "mc.example.com",
+		},
+		{
+			name: "exact is case insensitive with trailing dot", hostname: "MC.Example.COM.", port: 25565, listenPort: 25565,
+			want: exact, wantPattern: "mc.example.com",
+		},
+		{
+			name: "exact with port before exact", hostname: "mc.example.com", port: 25566, listenPort: 25565,
+			want: exactPort, wantPattern: "mc.example.com:25566",
+		},
+		{
+			name: "exact before wildcard", hostname: "other.example.com", port: 25565, listenPort: 25565,
+			want: exactPort, wantPattern: "other.example.com",
+		},
+		{
+			name: "longest wildcard first", hostname: "a.survival.example.com", port: 25565, listenPort: 25565,
+			want: specific, wantPattern: "*.survival.example.com",
+		},
+		{
+			name: "wildcard", hostname: "a.example.com", port: 25565, listenPort: 25565,
+			want: wildcard, wantPattern: "*.example.com",
+		},
+		{
+			name: "wildcard doesn't match its own domain", hostname: "example.com", port: 25565, listenPort: 25565,
+			want: globalDefault, wantPattern: "default",
+		},
+		{
+			name: "regex with captures", hostname: "nether.worlds.example.net", port: 25565, listenPort: 25565,
+			want: regex, wantPattern: `~^(?P<world>[a-z]+)\.worlds\.example\.net$`,
+			wantCaptures: map[string]string{"world": "nether"},
+		},
+		{
+			name: "regexes in configuration order", hostname: "first.example.net", port: 25565, listenPort: 25565,
+			want: firstRegex, wantPattern: `~first\..*`, wantCaptures: map[string]string{},
+		},
+		{
+			name: "later regex", hostname: "a.b.example.net", port: 25565, listenPort: 25565,
+			want: firstRegex, wantPattern: `~.*\.example\.net`, wantCaptures: map[string]string{},
+		},
+		{
+			name: "regex matches the whole hostname", hostname: "mc.example.org", port: 25565, listenPort: 25565,
+			want: unanchored, wantPattern: `~mc\.example\.org`, wantCaptures: map[string]string{},
+		},
+		{
+			name: "regex doesn't match part of the hostname", hostname: "evilmc.example.org.attacker.net", port: 25565, listenPort: 25565,
+			want: globalDefault, wantPattern: "default",
+		},
+		{
+			name: "server not on listener port", hostname: "creative.example.org", port: 25565, listenPort: 25565,
+			want: globalDefault, wantPattern: "default",
+		},
+		{
+			name: "server on listener port", hostname: "creative.example.org", port: 25570, listenPort: 25570,
+			want: portOnly, wantPattern: "creative.example.org",
+		},
+		{
+			name: "port default before global default", hostname: "unknown.example.org", port: 25570, listenPort: 25570,
+			want: portDefault, wantPattern: "default",
+		},
+		{
+			name: "global default", hostname: "unknown.example.org", port: 25565, listenPort: 25565,
+			want: globalDefault, wantPattern: "default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Route(tt.hostname, tt.port, tt.listenPort)
+			if !ok {
+				t.Fatalf("Route() = false, want %q", tt.want.config.Hostname)
+			}
+			if got.Server != tt.want || got.Pattern != tt.wantPattern {
+				t.Errorf("Route() = %q (%q), want %q (%q)",
+					got.Server.config.Hostname, got.Pattern, tt.want.config.Hostname, tt.wantPattern)
+			}
+			if !maps.Equal(got.Captures, tt.wantCaptures) {
+				t.Errorf("Route() captures = %v, want %v", got.Captures, tt.wantCaptures)
+			}
+		})
+	}
+}
+
+func TestRouterRouteNoDefault(t *testing.T) {
+	r, err := NewRouter([]*Server{newTestServer(config.ServerConfig{Hostname: "mc.example.com"})})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	if got, ok := r.Route("other.example.com", 25565, 25565); ok {
+		t.Errorf("Route() = %q, want no match", got.Server.config.Hostname)
+	}
+}
+
+func TestNewRouterConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []config.ServerConfig
+		wantErr bool
+	}{
+		{
+			name: "same hostname",
+			servers: []config.ServerConfig{
+				{Hostname: "mc.example.com"},
+				{Hostname: "other.example.com", Hostnames: []string{"MC.example.com"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "same hostname on different ports",
+			servers: []config.ServerConfig{
+				{Hostname: "mc.example.com", Ports: []int{25565}},
+				{Hostname: "mc.example.com", Ports: []int{25566}},
+			},
+		},
+		{
+			name: "two defaults",
+			servers: []config.ServerConfig{
+				{Hostname: "a.example.com", Default: true},
+				{Hostname: "b.example.com", Default: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "defaults on different ports",
+			servers: []config.ServerConfig{
+				{Hostname: "a.example.com", Default: true, Ports: []int{25565}},
+				{Hostname: "b.example.com", Default: true, Ports: []int{25566}},
+			},
+		},
+		{
+			name:    "invalid regex",
+			servers: []config.ServerConfig{{Hostname: "~("}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := make([]*Server, 0, len(tt.servers))
+			for _, conf := range tt.servers {
+				servers = append(servers, newTestServer(conf))
+			}
+
+			if _, err := NewRouter(servers); (err != nil) != tt.wantErr {
+				t.Errorf("NewRouter() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/schedule"
+)
+
+// serverSchedule contains the parsed schedule of a server.
+type serverSchedule struct {
+	// loc is the time zone the schedule is evaluated in.
+	loc *time.Location
+
+	// prewarm contains the windows to start the server in.
+	prewarm []*schedule.Window
+
+	// keepAlive contains the windows to not stop the server in.
+	keepAlive []*schedule.Window
+
+	// blackout contains the windows to not start the server in.
+	blackout []*schedule.Window
+}
+
+// scheduledEvent is an upcoming change in a server's schedule.
+type scheduledEvent struct {
+	// name describes the event, e.g. "prewarm starts".
+	name string
+
+	// at is when the event happens, in the schedule's time zone.
+	at time.Time
+}
+
+// newServerSchedule parses the provided schedule configuration.
+func newServerSchedule(conf *config.ScheduleConfig) (*serverSchedule, error) {
+	loc, err := conf.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &serverSchedule{loc: loc}
+	for _, windows := range []struct {
+		dst  *[]*schedule.Window
+		conf []config.WindowConfig
+	}{
+		{&s.prewarm, conf.Prewarm},
+		{&s.keepAlive, conf.KeepAlive},
+		{&s.blackout, conf.Blackout.Windows},
+	} {
+		for i := range windows.conf {
+			w, err := windows.conf[i].Window()
+			if err != nil {
+				return nil, err
+			}
+			*windows.dst = append(*windows.dst, w)
+		}
+	}
+
+	return s, nil
+}
+
+// activeUntil returns when the last of the provided windows active at t
+// ends, if any are.
+func activeUntil(windows []*schedule.Window, t time.Time) (time.Time, bool) {
+	var until time.Time
+	for _, w := range windows {
+		if end, ok := w.Active(t); ok && end.After(until) {
+			until = end
+		}
+	}
+
+	return until, !until.IsZero()
+}
+
+// prewarmUntil returns when the prewarm windows active at t end, if any
+// are.
+func (s *serverSchedule) prewarmUntil(t time.Time) (time.Time, bool) {
+	return activeUntil(s.prewarm, t.In(s.loc))
+}
+
+// keepAliveUntil returns when the windows keeping the server alive at t
+// end, if any are. Prewarm windows keep the server alive too.
+func (s *serverSchedule) keepAliveUntil(t time.Time) (time.Time, bool) {
+	return activeUntil(slices.Concat(s.prewarm, s.keepAlive), t.In(s.loc))
+}
+
+// blackoutUntil returns when the blackout windows active at t end, if
+// any are.
+func (s *serverSchedule) blackoutUntil(t time.Time) (time.Time, bool) {
+	return activeUntil(s.blackout, t.In(s.loc))
+}
+
+// next returns the first event of the schedule after t, if there is one.
+func (s *serverSchedule) next(t time.Time) (scheduledEvent, bool) {
+	t = t.In(s.loc)
+
+	var next scheduledEvent
+	consider := func(name string, at time.Time) {
+		if !at.IsZero() && (next.at.IsZero() || at.Before(next.at)) {
+			next = scheduledEvent{name: name, at: at}
+		}
+	}
+
+	for _, windows := range []struct {
+		name    string
+		windows []*schedule.Window
+	}{{"prewarm", s.prewarm}, {"keep alive", s.keepAlive}, {"blackout", s.blackout}} {
+		for _, w := range windows.windows {
+			if end, ok := w.Active(t); ok {
+				consider(windows.name+" ends", end)
+			}
+			consider(windows.name+" starts", w.Schedule.Next(t))
+		}
+	}
+
+	return next, !next.at.IsZero()
+}
+
+// stopForBlackout drains the server, giving players the configured
+// drain timeout to leave, and then stops it. Nothing is done if the
+// server is already being stopped for a blackout.
+func (s *Server) stopForBlackout(ctx context.Context) {
+	if !s.blackoutStopping.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.blackoutStopping.Store(false)
+
+	timeout := s.config.Schedule.Blackout.DrainTimeout
+	s.log.Info("Stopping server for blackout", "drain_timeout", timeout)
+	if err := s.Drain(ctx, timeout); err != nil {
+		s.log.Warn("Failed to drain server", "err", err)
+	}
+
+	if err := s.Stop(ctx); err != nil {
+		s.log.Error("failed to stop server", "err", err)
+	}
+
+	// Accept players again once the server is started after the
+	// blackout.
+	s.SetDraining(false)
+}
@@ -18,16 +18,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"charm.land/log/v2"
 	mcnet "github.com/Tnze/go-mc/net"
+	"github.com/pkg/errors"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud/docker"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud/gcp"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
 	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+	"golang.org/x/sync/singleflight"
 )
 
 // Server is a proxy server
@@ -53,6 +56,119 @@ type Server struct {
 
 	// connections is the number of connections we have
 	connections atomic.Uint64
+
+	// readyProbes is the number of consecutive successful status pings
+	// since the server was last seen not running. The server becomes
+	// ready once this reaches the configured ReadyAfter.
+	readyProbes atomic.Uint64
+
+	// pings ensures only one status ping is in-flight at a time,
+	// concurrent callers share its result.
+	pings singleflight.Group
+
+	// statusCache is the last successful status ping of the Minecraft
+	// server. It's cleared when the server is seen not running.
+	statusCache atomic.Pointer[cachedStatus]
+
+	// status contains the parsed status configuration.
+	status *statusTemplates
+
+	// messages contains the messages sent to the server's players.
+	messages *messageCatalog
+
+	// lastPlayer is the last player to log in to the server.
+	lastPlayer atomic.Pointer[seenPlayer]
+
+	// startedAt is when the proxy last started the server. It's cleared
+	// once the server is ready.
+	startedAt atomic.Pointer[time.Time]
+
+	// bootTime is how long the server took to become ready the last
+	// time the proxy started it, as a time.Duration.
+	bootTime atomic.Int64
+
+	// stateDir is the directory the server's state is persisted in. If
+	// empty, state isn't persisted.
+	stateDir string
+
+	// stateMu protects state.
+	stateMu sync.Mutex
+
+	// state is the server's persisted state.
+	state serverState
+
+	// draining is set when the server doesn't accept new players.
+	draining atomic.Bool
+
+	// drainDeadline is when players still online are disconnected from
+	// the draining server.
+	drainDeadline atomic.Pointer[time.Time]
+
+	// activeMu protects active.
+	activeMu sync.Mutex
+
+	// active contains the connections being proxied to the server.
+	active map[*Connection]struct{}
+
+	// lifecycleMu protects lifecycle, lifecycleSince and subscribers.
+	lifecycleMu sync.Mutex
+
+	// lifecycle is the server's current state, see State.
+	lifecycle State
+
+	// lifecycleSince is when the server entered its current state.
+	lifecycleSince time.Time
+
+	// subscribers receive the server's state transitions.
+	subscribers map[chan Transition]struct{}
+
+	// lastSync is when the state was last synced with the cloud
+	// provider, as Unix nanoseconds.
+	lastSync atomic.Int64
+
+	// providerStatus is the status last reported by the cloud provider,
+	// nil if it hasn't been synced yet.
+	providerStatus atomic.Pointer[cloud.ProviderStatus]
+
+	// syncs ensures only one sync with the cloud provider is in-flight
+	// at a time, see Refresh.
+	syncs singleflight.Group
+
+	// startFailures is the number of consecutive failed starts, see
+	// checkTimeouts.
+	startFailures atomic.Int64
+
+	// retryAt is when to retry starting the server, if a retry is
+	// scheduled.
+	retryAt atomic.Pointer[time.Time]
+
+	// recovering is set while the server is being restarted after it
+	// was preempted, see preempted.
+	recovering atomic.Bool
+
+	// schedule is the server's schedule of prewarm, keep alive and
+	// blackout windows.
+	schedule *serverSchedule
+
+	// blackoutStopping is set while the server is being stopped for a
+	// blackout, see stopForBlackout.
+	blackoutStopping atomic.Bool
+
+	// auth authenticates players before their identity is forwarded to
+	// the server. It's nil if forwarding is disabled.
+	auth *minecraft.Authenticator
+}
+
+// seenPlayer is a player that was seen on a server.
+type seenPlayer struct {
+	name   string
+	seenAt time.Time
+}
+
+// cachedStatus is a status ping result.
+type cachedStatus struct {
+	status    *minecraft.Status
+	fetchedAt time.Time
 }
 
 // GetCloudProviderForConfig returns a cloud provider for the provided config
@@ -84,60 +200,269 @@ func GetCloudProviderForConfig(conf *config.ServerConfig) (cloud.Provider, strin
 	return cloudProvider, instanceID, err
 }
 
-// NewServer creates a new server
+// NewServer creates a new server from its configuration, conf, which is
+// part of the proxy configuration pconf.
 //
 //nolint:gocritic // Why: OK shadowing log.
-func NewServer(log *log.Logger, conf *config.ServerConfig) (*Server, error) {
+func NewServer(log *log.Logger, pconf *config.ProxyConfig, conf *config.ServerConfig) (*Server, error) {
 	cloudProvider, instanceID, err := GetCloudProviderForConfig(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{
+	status, err := newStatusTemplates(&conf.Status)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid status config")
+	}
+
+	messages, err := newMessageCatalog(log, pconf.Messages[conf.Language], conf.Messages)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid messages")
+	}
+
+	sched, err := newServerSchedule(&conf.Schedule)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid schedule")
+	}
+
+	s := &Server{
 		cloud:      cloudProvider,
 		instanceID: instanceID,
 		log:        log,
 		config:     conf,
-	}, nil
+		status:     status,
+		messages:   messages,
+		stateDir:   pconf.StateDir,
+		active:     make(map[*Connection]struct{}),
+		schedule:   sched,
+
+		lifecycle:      StateUnknown,
+		lifecycleSince: time.Now(),
+		subscribers:    make(map[chan Transition]struct{}),
+	}
+
+	// Servers that trust forwarded identities run in offline mode, so
+	// players have to be authenticated by us if they should be verified.
+	if conf.Minecraft.Authenticate {
+		s.auth, err = minecraft.NewAuthenticator()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create authenticator")
+		}
+	}
+
+	// A missing or broken state file only means the offline status
+	// won't be as accurate until the server is seen running.
+	if err := s.loadState(); err != nil {
+		log.Warn("Failed to load server state", "path", s.statePath(), "err", err)
+	}
+
+	return s, nil
+}
+
+// Probe pings the Minecraft server and records the result towards the
+// server's readiness, moving it between warming up and ready. It returns
+// the server's status and whether or not the server is now ready.
+func (s *Server) Probe() (*minecraft.Status, bool, error) {
+	mcStatus, err := s.GetMinecraftStatus()
+	if err != nil {
+		s.readyProbes.Store(0)
+		s.transition(StateWarmingUp, "status ping failed: "+err.Error(), StateReady, StateDraining)
+		return nil, false, err
+	}
+
+	if mcStatus.Version != nil {
+		s.recordStatus(mcStatus)
+	}
+
+	ready := StateReady
+	if s.draining.Load() {
+		ready = StateDraining
+	}
+
+	probes := s.readyProbes.Add(1)
+	if probes >= uint64(s.config.Minecraft.ReadyAfter) && s.transition(ready, "server answered status pings", StateWarmingUp) {
+		// Track how long the server took to boot, to estimate when it'll
+		// be ready next time.
+		if startedAt := s.startedAt.Swap(nil); startedAt != nil {
+			s.bootTime.Store(int64(time.Since(*startedAt)))
+		}
+		s.startFailures.Store(0)
+		s.recovering.Store(false)
+	}
+
+	return mcStatus, s.IsReady(), nil
 }
 
-// GetStatus returns the status of the server
-func (s *Server) GetStatus(ctx context.Context) (cloud.ProviderStatus, error) {
-	return s.cloud.Status(ctx, s.instanceID)
+// statusFallbackTTLs is how many StatusCacheTTLs old the last
+// successful status may be to be returned when a ping fails.
+const statusFallbackTTLs = 3
+
+// CachedProbe is like Probe, but is meant for answering status
+// requests. If the server is ready, a status younger than the
+// configured StatusCacheTTL is returned without pinging the server. If
+// the ping of a ready server fails, the last successful status is
+// returned instead, if it's recent enough.
+func (s *Server) CachedProbe() (*minecraft.Status, bool, error) {
+	ttl := s.config.Minecraft.StatusCacheTTL
+	cached := s.statusCache.Load()
+	wasReady := s.IsReady()
+	if cached != nil && wasReady && time.Since(cached.fetchedAt) < ttl {
+		return cached.status, true, nil
+	}
+
+	mcStatus, ready, err := s.Probe()
+	if err != nil && cached != nil && wasReady && time.Since(cached.fetchedAt) < statusFallbackTTLs*ttl {
+		s.log.Debug("Failed to ping server, using last known status", "err", err, "age", time.Since(cached.fetchedAt))
+		return cached.status, ready, nil
+	}
+
+	return mcStatus, ready, err
 }
 
-// GetMinecraftStatus return the minecraft server's status, this requires
-// the server to be running.
+// GetMinecraftStatus pings the minecraft server for its status, this
+// requires the server to be running. Concurrent callers share a single
+// ping.
 func (s *Server) GetMinecraftStatus() (*minecraft.Status, error) {
-	return minecraft.GetServerStatus(s.config.Minecraft.Hostname, s.config.Minecraft.Port)
-}
+	v, err, _ := s.pings.Do("status", func() (any, error) {
+		mcStatus, err := minecraft.GetServerStatus(s.config.Minecraft.Hostname,
+			s.config.Minecraft.Port, s.config.Minecraft.PingTimeout)
+		if err != nil {
+			return nil, err
+		}
 
-// Stop stops the server
-func (s *Server) Stop(ctx context.Context) error {
-	status, err := s.cloud.Status(ctx, s.instanceID)
+		s.statusCache.Store(&cachedStatus{status: mcStatus, fetchedAt: time.Now()})
+		return mcStatus, nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// if the server is already stopped, don't stop it
-	if status == cloud.StatusStopped {
+	mcStatus, ok := v.(*minecraft.Status)
+	if !ok {
+		return nil, errors.Errorf("unexpected status type %T", v)
+	}
+	return mcStatus, nil
+}
+
+// SawPlayer records that the player with the provided name was seen on
+// the server.
+func (s *Server) SawPlayer(name string) {
+	s.lastPlayer.Store(&seenPlayer{name: name, seenAt: time.Now()})
+}
+
+// addConnection counts a player connecting to the server, unless it
+// already has its configured maximum number of players, in which case
+// false is returned. The check and the count are a single step, so
+// concurrent logins can't exceed the maximum.
+func (s *Server) addConnection() bool {
+	maxPlayers := uint64(max(s.config.MaxPlayers, 0))
+	for {
+		n := s.connections.Load()
+		if maxPlayers > 0 && n >= maxPlayers {
+			return false
+		}
+		if s.connections.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// WaitForReady blocks until the server is running and ready to accept
+// players. The server is checked every interval, and started if it
+// finished stopping in the meantime. An error is returned if the context
+// is cancelled before the server is ready, if the server failed to
+// start, or if it isn't running and a blackout has begun.
+func (s *Server) WaitForReady(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		state, err := s.Refresh(ctx)
+		if err != nil {
+			s.log.Warn("failed to get server status while waiting for server", "err", err)
+		}
+
+		// Servers that aren't running, or are being stopped, won't be
+		// started again until the blackout ends.
+		if _, ok := s.schedule.blackoutUntil(time.Now()); ok && (state == StateStopped || state == StateStopping) {
+			return errServerBlackout
+		}
+
+		switch state {
+		case StateStopped:
+			if err := s.Start(ctx); err != nil {
+				s.log.Warn("failed to start server while waiting for server", "err", err)
+			}
+		case StateWarmingUp:
+			s.Probe() //nolint:errcheck // Why: Readiness is checked below.
+		case StateFailed:
+			return errServerFailed
+		case StateUnknown, StateStarting, StateReady, StateDraining, StateStopping:
+		}
+
+		if s.IsReady() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Stop stops the server, if it's running. The server stays stopping
+// until the cloud provider reports it stopped, see Sync. If the cloud
+// provider fails to stop it, the server's state is unknown until it's
+// next synced.
+func (s *Server) Stop(ctx context.Context) error {
+	if !s.transition(StateStopping, "stop requested", StateWarmingUp, StateReady, StateDraining) {
 		return nil
 	}
 
-	return s.cloud.Stop(ctx, s.instanceID)
+	if err := s.cloud.Stop(ctx, s.instanceID); err != nil {
+		if s.transition(StateUnknown, "stop failed: "+err.Error(), StateStopping) {
+			// Sync with the provider on next use.
+			s.lastSync.Store(0)
+		}
+		return err
+	}
+
+	return nil
 }
 
-// Start starts the server
+// Start starts the server, if it's stopped. Only one caller starts the
+// server, concurrent callers return immediately. While a retry of a
+// failed start is backing off, or during a blackout, nothing is done.
 func (s *Server) Start(ctx context.Context) error {
-	status, err := s.cloud.Status(ctx, s.instanceID)
-	if err != nil {
-		return err
+	if retryAt := s.retryAt.Load(); retryAt != nil && time.Now().Before(*retryAt) {
+		return nil
+	}
+
+	if until, ok := s.schedule.blackoutUntil(time.Now()); ok {
+		s.log.Info("Not starting server during blackout", "until", until)
+
+		// Put off pending retries, e.g. restarting a preempted server,
+		// until the blackout ends rather than trying on every check.
+		if s.retryAt.Load() != nil {
+			s.retryAt.Store(&until)
+		}
+		return nil
 	}
 
-	// if the server is already running, don't start it
-	if status == cloud.StatusRunning {
+	if !s.transition(StateStarting, "start requested", StateUnknown, StateStopped) {
 		return nil
 	}
 
-	return s.cloud.Start(ctx, s.instanceID)
+	s.retryAt.Store(nil)
+	if err := s.cloud.Start(ctx, s.instanceID); err != nil {
+		s.transition(StateStopped, "start failed: "+err.Error(), StateStarting)
+		s.startFailed(ctx, err.Error(), false)
+		return err
+	}
+
+	now := time.Now()
+	s.startedAt.Store(&now)
+	return nil
 }
@@ -0,0 +1,100 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/cloud"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/schedule"
+)
+
+func TestServerAddConnection(t *testing.T) {
+	s := newLifecycleTestServer(&fakeProvider{}, config.ServerConfig{MaxPlayers: 5})
+
+	// Logins racing each other never exceed the maximum.
+	var wg sync.WaitGroup
+	var added atomic.Int64
+	for range 50 {
+		wg.Go(func() {
+			if s.addConnection() {
+				added.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := added.Load(); got != 5 {
+		t.Errorf("addConnection() succeeded %d times, want 5", got)
+	}
+	if got := s.connections.Load(); got != 5 {
+		t.Errorf("connections = %d, want 5", got)
+	}
+
+	// Leaving frees up a slot.
+	s.connections.Add(^uint64(0))
+	if !s.addConnection() {
+		t.Error("addConnection() = false after a player left, want true")
+	}
+
+	unlimited := newLifecycleTestServer(&fakeProvider{}, config.ServerConfig{})
+	for range 10 {
+		if !unlimited.addConnection() {
+			t.Fatal("addConnection() = false without maxPlayers, want true")
+		}
+	}
+}
+
+func TestWaitForReadyBlackout(t *testing.T) {
+	always, err := schedule.Parse("* * * * *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		state    State
+		provider cloud.ProviderStatus
+	}{
+		{name: "stopping", state: StateStopping, provider: cloud.StatusStopping},
+		{name: "stopped", state: StateStopped, provider: cloud.StatusStopped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{status: tt.provider}
+			s := newLifecycleTestServer(provider, config.ServerConfig{})
+			s.schedule.blackout = []*schedule.Window{{Schedule: always, Duration: time.Hour}}
+			s.transition(tt.state, "test")
+
+			ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+			defer cancel()
+
+			if err := s.WaitForReady(ctx, time.Millisecond); !errors.Is(err, errServerBlackout) {
+				t.Errorf("WaitForReady() error = %v, want %v", err, errServerBlackout)
+			}
+			if provider.starts != 0 {
+				t.Errorf("provider started %d times during blackout, want 0", provider.starts)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+// unsafeFilenameChars matches characters that are escaped in state file
+// names. "_" starts an escape, so it's escaped as well.
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// serverState is the state of a server that is persisted across proxy
+// restarts.
+type serverState struct {
+	// LastStatus is the last status received from the Minecraft server.
+	// Only the fields that don't change while the server is running are
+	// stored.
+	LastStatus *minecraft.Status `json:"lastStatus,omitempty"`
+
+	// Preemptions is the number of times the server was preempted.
+	Preemptions int64 `json:"preemptions,omitempty"`
+
+	// History contains the server's most recent events, oldest first.
+	History []HistoryEvent `json:"history,omitempty"`
+}
+
+// maxHistory is the number of events kept in a server's history.
+const maxHistory = 100
+
+// HistoryEvent is a notable event in a server's life.
+type HistoryEvent struct {
+	// At is when the event happened.
+	At time.Time `json:"at"`
+
+	// Event is what happened, e.g. "preempted".
+	Event string `json:"event"`
+
+	// State is the state the server was in.
+	State State `json:"state"`
+
+	// Players is the number of players connected through the proxy.
+	Players uint64 `json:"players"`
+}
+
+// statePath returns the path to the server's state file. An empty
+// string is returned if state isn't persisted.
+func (s *Server) statePath() string {
+	if s.stateDir == "" {
+		return ""
+	}
+
+	return filepath.Join(s.stateDir, stateFilename(s.config.Hostname))
+}
+
+// stateFilename returns the name of the state file for the provided
+// hostname. Unsafe characters are escaped as "_" followed by the hex
+// value of each of their bytes, so that no two hostnames share a file.
+func stateFilename(hostname string) string {
+	return unsafeFilenameChars.ReplaceAllStringFunc(hostname, func(c string) string {
+		var b strings.Builder
+		for i := range len(c) {
+			fmt.Fprintf(&b, "_%02x", c[i])
+		}
+		return b.String()
+	}) + ".json"
+}
+
+// loadState restores the server's state from its state file, if there
+// is one.
+func (s *Server) loadState() error {
+	path := s.statePath()
+	if path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read state file")
+	}
+
+	var state serverState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return errors.Wrap(err, "failed to parse state file")
+	}
+
+	if state.LastStatus != nil {
+		s.lastMinecraftStatus.Store(state.LastStatus)
+	}
+	s.state = state
+
+	return nil
+}
+
+// saveState writes the server's state to its state file. The file is
+// replaced atomically, so a crash never leaves a partial file behind.
+func (s *Server) saveState() error {
+	path := s.statePath()
+	if path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.stateDir, 0o750); err != nil {
+		return errors.Wrap(err, "failed to create state directory")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write state file")
+	}
+
+	return errors.Wrap(os.Rename(tmp, path), "failed to replace state file")
+}
+
+// recordStatus stores the provided status as the server's last known
+// status, persisting it if it changed since it was last saved.
+func (s *Server) recordStatus(mcStatus *minecraft.Status) {
+	s.lastMinecraftStatus.Store(mcStatus)
+
+	// The player count changes all the time, only persist what's shown
+	// while the server is offline.
+	last := &minecraft.Status{
+		Version:     mcStatus.Version,
+		Description: mcStatus.Description,
+		Favicon:     mcStatus.Favicon,
+	}
+	if mcStatus.Players != nil {
+		last.Players = &minecraft.StatusPlayers{Max: mcStatus.Players.Max}
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	old, err := json.Marshal(s.state.LastStatus)
+	if err != nil {
+		return
+	}
+	updated, err := json.Marshal(last)
+	if err != nil || string(old) == string(updated) {
+		return
+	}
+
+	s.state.LastStatus = last
+	if err := s.saveState(); err != nil {
+		s.log.Warn("Failed to save server state", "err", err)
+	}
+}
+
+// recordEvent appends the provided event to the server's history and
+// persists it.
+func (s *Server) recordEvent(e HistoryEvent) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.state.History = append(s.state.History, e)
+	if n := len(s.state.History); n > maxHistory {
+		s.state.History = slices.Clone(s.state.History[n-maxHistory:])
+	}
+	if e.Event == eventPreempted {
+		s.state.Preemptions++
+	}
+
+	if err := s.saveState(); err != nil {
+		s.log.Warn("Failed to save server state", "err", err)
+	}
+}
+
+// History returns the server's most recent events, oldest first.
+func (s *Server) History() []HistoryEvent {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return append([]HistoryEvent{}, s.state.History...)
+}
+
+// preemptions returns the number of times the server was preempted.
+func (s *Server) preemptions() int64 {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.state.Preemptions
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestStateFilename(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{hostname: "mc.example.com", want: "mc.example.com.json"},
+		{hostname: "MC-1.example.com", want: "MC-1.example.com.json"},
+		{hostname: "a_b", want: "a_5fb.json"},
+		{hostname: "a/b", want: "a_2fb.json"},
+		{hostname: "../etc", want: ".._2fetc.json"},
+		{hostname: "é", want: "_c3_a9.json"},
+	}
+
+	seen := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			got := stateFilename(tt.hostname)
+			if got != tt.want {
+				t.Errorf("stateFilename(%q) = %q, want %q", tt.hostname, got, tt.want)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("stateFilename(%q) = %q, same as for %q", tt.hostname, got, other)
+			}
+			seen[got] = tt.hostname
+		})
+	}
+
+	// Hostnames that used to share a file no longer do.
+	if stateFilename("a.b") == stateFilename("a_b") {
+		t.Errorf("stateFilename(%q) = stateFilename(%q)", "a.b", "a_b")
+	}
+}
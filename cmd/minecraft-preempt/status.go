@@ -0,0 +1,317 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+// pngSignature is the signature every PNG file starts with.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// statusTemplateFuncs are the functions available to status templates.
+var statusTemplateFuncs = template.FuncMap{
+	// since returns the time since the provided time, rounded to the
+	// second.
+	"since": func(t time.Time) time.Duration {
+		return time.Since(t).Round(time.Second)
+	},
+}
+
+// statusTemplates contains the parsed status configuration of a server.
+type statusTemplates struct {
+	// motd contains the MOTD templates for each state. States without a
+	// template aren't present.
+	motd map[State]*chatTemplate
+
+	// versionLabel is the version label template, if any.
+	versionLabel *template.Template
+
+	// favicon is the configured favicon as a data URI, if any.
+	favicon string
+}
+
+// statusVars are the variables available to status templates.
+type statusVars struct {
+	// Server is the hostname of the server.
+	Server string
+
+	// State is the state of the server, e.g. "STOPPED" or "WARMING UP".
+	State string
+
+	// ShutdownIn is how long until the server is stopped if it stays
+	// empty. It's 0 unless the server is running and empty.
+	ShutdownIn time.Duration
+
+	// LastPlayer is the name of the last player to log in, if any.
+	LastPlayer string
+
+	// LastSeen is when LastPlayer was last seen.
+	LastSeen time.Time
+
+	// BootTime is how long the server took to become ready the last
+	// time it was started by the proxy. It's 0 if unknown.
+	BootTime time.Duration
+
+	// ReadyIn is the estimated time until a starting server is ready,
+	// based on BootTime. It's 0 if unknown.
+	ReadyIn time.Duration
+
+	// NextEvent describes the next event of the server's schedule, e.g.
+	// "prewarm starts". It's empty if nothing is scheduled.
+	NextEvent string
+
+	// NextEventAt is when NextEvent happens, in the schedule's time
+	// zone.
+	NextEventAt time.Time
+
+	// NextEventIn is the time until NextEvent happens.
+	NextEventIn time.Duration
+}
+
+// newStatusTemplates parses the provided status configuration.
+func newStatusTemplates(conf *config.StatusConfig) (*statusTemplates, error) {
+	t := &statusTemplates{motd: make(map[State]*chatTemplate)}
+
+	for state, text := range map[State]string{
+		StateStopped:  conf.MOTD.Stopped,
+		StateStarting: conf.MOTD.Starting,
+		StateStopping: conf.MOTD.Stopping,
+		StateUnknown:  conf.MOTD.Unknown,
+		StateFailed:   conf.MOTD.Failed,
+	} {
+		if text == "" {
+			continue
+		}
+
+		tmpl, err := parseChatTemplate(string(state), text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s motd template", strings.ToLower(string(state)))
+		}
+		t.motd[state] = tmpl
+	}
+
+	if conf.VersionLabel != "" {
+		tmpl, err := template.New("versionLabel").Funcs(statusTemplateFuncs).Parse(conf.VersionLabel)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse version label template")
+		}
+		t.versionLabel = tmpl
+	}
+
+	if conf.Favicon != "" {
+		b, err := os.ReadFile(conf.Favicon)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read favicon")
+		}
+		if !bytes.HasPrefix(b, pngSignature) {
+			return nil, fmt.Errorf("favicon %q is not a PNG file", conf.Favicon)
+		}
+
+		t.favicon = "data:image/png;base64," + base64.StdEncoding.EncodeToString(b)
+	}
+
+	return t, nil
+}
+
+// statusVars returns the status template variables for the server.
+// stateText is the state shown to players.
+func (s *Server) statusVars(stateText string) *statusVars {
+	vars := &statusVars{
+		Server:   s.config.Hostname,
+		State:    stateText,
+		BootTime: time.Duration(s.bootTime.Load()),
+	}
+
+	if emptySince := s.emptySince.Load(); emptySince != nil && s.connections.Load() == 0 {
+		vars.ShutdownIn = max(time.Until(emptySince.Add(s.config.ShutdownAfter)), 0).Round(time.Second)
+	}
+
+	if p := s.lastPlayer.Load(); p != nil {
+		vars.LastPlayer = p.name
+		vars.LastSeen = p.seenAt
+	}
+
+	if next, ok := s.schedule.next(time.Now()); ok {
+		vars.NextEvent = next.name
+		vars.NextEventAt = next.at
+		vars.NextEventIn = time.Until(next.at).Round(time.Second)
+	}
+
+	vars.ReadyIn = s.readyIn()
+	return vars
+}
+
+// readyIn returns the estimated time until the server is ready, based
+// on how long it took to start last time. It's 0 if unknown, or the
+// server isn't being started by the proxy.
+func (s *Server) readyIn() time.Duration {
+	bootTime := time.Duration(s.bootTime.Load())
+	startedAt := s.startedAt.Load()
+	if startedAt == nil || bootTime == 0 {
+		return 0
+	}
+
+	return max(bootTime-time.Since(*startedAt), 0).Round(time.Second)
+}
+
+// bootProgress returns how far along the server is in starting, between
+// 0 and 1, based on how long it took to start last time. It's 0 if
+// unknown.
+func (s *Server) bootProgress() float32 {
+	if s.IsReady() {
+		return 1
+	}
+
+	bootTime := time.Duration(s.bootTime.Load())
+	startedAt := s.startedAt.Load()
+	if startedAt == nil || bootTime == 0 {
+		return 0
+	}
+
+	return float32(min(float64(time.Since(*startedAt))/float64(bootTime), 1))
+}
+
+// defaultProtocolVersion is the protocol version shown while the server
+// is offline if nothing better is known. 754 is 1.16.4 and 1.16.5.
+const defaultProtocolVersion = 754
+
+// labelProtocolVersion is the protocol version shown with a version
+// label. Clients only show the version name if the protocol version
+// doesn't match their own, which no client's does.
+const labelProtocolVersion = -1
+
+// offlineStatus returns the status to show to clients while the server
+// isn't running, or isn't ready yet, in the provided state.
+// clientProtocol is the protocol version of the client asking, 0 if
+// unknown.
+func (s *Server) offlineStatus(state State, clientProtocol int32) *minecraft.Status {
+	v := s.offlineVersion(clientProtocol)
+	var favicon string
+	var maxPlayers int
+
+	if last := s.lastMinecraftStatus.Load(); last != nil {
+		if last.Players != nil {
+			maxPlayers = last.Players.Max
+		}
+		favicon = last.Favicon
+	}
+	if s.status.favicon != "" {
+		favicon = s.status.favicon
+	}
+
+	vars := s.statusVars(string(state))
+	if s.status.versionLabel != nil {
+		var b strings.Builder
+		if err := s.status.versionLabel.Execute(&b, vars); err != nil {
+			s.log.Warn("Failed to render version label", "err", err)
+		} else {
+			v.Name = b.String()
+			v.Protocol = labelProtocolVersion
+		}
+	}
+
+	return &minecraft.Status{
+		Version: v,
+		Players: &minecraft.StatusPlayers{
+			Max:    maxPlayers,
+			Online: 0,
+		},
+		Description: s.motd(state, vars),
+		Favicon:     favicon,
+	}
+}
+
+// offlineVersion returns the version to show to clients while the
+// server is offline. In order of preference, this is the configured
+// version, the version of the last status received from the server or
+// the client's own version, so that clients don't show the server as
+// incompatible when we don't know better.
+func (s *Server) offlineVersion(clientProtocol int32) *minecraft.StatusVersion {
+	if release := s.config.Minecraft.Version; release != "" {
+		// Validated when the config was loaded.
+		protocol, _ := minecraft.ProtocolForRelease(release)
+		return &minecraft.StatusVersion{Name: release, Protocol: int(protocol)}
+	}
+
+	if last := s.lastMinecraftStatus.Load(); last != nil && last.Version != nil {
+		return &minecraft.StatusVersion{Name: last.Version.Name, Protocol: last.Version.Protocol}
+	}
+
+	if clientProtocol != 0 {
+		name, ok := minecraft.ReleaseForProtocol(clientProtocol)
+		if !ok {
+			name = "unknown"
+		}
+		return &minecraft.StatusVersion{Name: name, Protocol: int(clientProtocol)}
+	}
+
+	return &minecraft.StatusVersion{Name: "unknown", Protocol: defaultProtocolVersion}
+}
+
+// motd renders the MOTD for the provided state. Warming up servers use
+// the starting template. If there's no template for the state, or it
+// fails to render, a MOTD containing the state is returned. Stopped
+// servers, and servers in an unknown state, use the MOTD of the last
+// status received from the server instead, if there is one.
+func (s *Server) motd(state State, vars *statusVars) *minecraft.Chat {
+	fallback := &minecraft.Chat{Text: fmt.Sprintf("Server status: %s", vars.State)}
+	if state == StateStopped || state == StateUnknown {
+		if last := s.lastMinecraftStatus.Load(); last != nil && last.Description != nil {
+			fallback = last.Description
+		}
+	}
+
+	if state == StateWarmingUp {
+		state = StateStarting
+	}
+
+	tmpl, ok := s.status.motd[state]
+	if !ok {
+		tmpl, ok = s.status.motd[StateUnknown]
+	}
+	if !ok {
+		return fallback
+	}
+
+	motd, err := tmpl.render(vars)
+	if err != nil {
+		s.log.Warn("Failed to render motd", "state", state, "err", err)
+		return fallback
+	}
+
+	return motd
+}
+
+// jsonEscaped implements chatVars.
+func (v *statusVars) jsonEscaped() chatVars {
+	escaped := *v
+	escaped.Server = jsonEscape(v.Server)
+	escaped.State = jsonEscape(v.State)
+	escaped.LastPlayer = jsonEscape(v.LastPlayer)
+	escaped.NextEvent = jsonEscape(v.NextEvent)
+	return &escaped
+}
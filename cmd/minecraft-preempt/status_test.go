@@ -0,0 +1,101 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/config"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+func TestOfflineStatusMOTD(t *testing.T) {
+	// Persist a status, as if the server was seen by a previous process.
+	dir := t.TempDir()
+	saved := newLifecycleTestServer(&fakeProvider{}, config.ServerConfig{Hostname: "mc.example.com"})
+	saved.stateDir = dir
+	saved.recordStatus(&minecraft.Status{
+		Version:     &minecraft.StatusVersion{Name: "1.21.4", Protocol: 769},
+		Description: &minecraft.Chat{Text: "A Minecraft Server"},
+	})
+
+	s := newLifecycleTestServer(&fakeProvider{}, config.ServerConfig{Hostname: "mc.example.com"})
+	s.stateDir = dir
+	s.status = &statusTemplates{motd: make(map[State]*chatTemplate)}
+	if err := s.loadState(); err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+
+	tests := []struct {
+		state State
+		want  string
+	}{
+		{state: StateStopped, want: "A Minecraft Server"},
+		{state: StateUnknown, want: "A Minecraft Server"},
+		{state: StateStarting, want: "Server status: STARTING"},
+		{state: StateWarmingUp, want: "Server status: WARMING UP"},
+		{state: StateStopping, want: "Server status: STOPPING"},
+		{state: StateFailed, want: "Server status: FAILED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			got := s.offlineStatus(tt.state, 0)
+			if got.Description == nil || got.Description.Text != tt.want {
+				b, _ := json.Marshal(got.Description)
+				t.Errorf("offlineStatus() description = %s, want %q", b, tt.want)
+			}
+			if got.Version.Protocol != 769 {
+				t.Errorf("offlineStatus() protocol = %d, want the saved 769", got.Version.Protocol)
+			}
+		})
+	}
+}
+
+func TestBootProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		startedAt time.Duration // ago, 0 if not started
+		bootTime  time.Duration
+		state     State
+		want      float32
+	}{
+		{"unknown boot time", time.Minute, 0, StateStarting, 0},
+		{"not started", 0, 2 * time.Minute, StateStarting, 0},
+		{"halfway", time.Minute, 2 * time.Minute, StateWarmingUp, 0.5},
+		{"slower than last time", 3 * time.Minute, 2 * time.Minute, StateWarmingUp, 1},
+		{"ready", time.Minute, 2 * time.Minute, StateReady, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newLifecycleTestServer(&fakeProvider{}, config.ServerConfig{})
+			s.transition(tt.state, "test")
+			s.bootTime.Store(int64(tt.bootTime))
+			if tt.startedAt != 0 {
+				startedAt := time.Now().Add(-tt.startedAt)
+				s.startedAt.Store(&startedAt)
+			}
+
+			if got := s.bootProgress(); math.Abs(float64(got-tt.want)) > 0.01 {
+				t.Errorf("bootProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
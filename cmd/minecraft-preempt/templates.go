@@ -0,0 +1,99 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+// templateActions matches the actions of a template, e.g. "{{ .Player }}".
+var templateActions = regexp.MustCompile(`(?s){{.*?}}`)
+
+// chatVars are the variables of a chat template.
+type chatVars interface {
+	// jsonEscaped returns a copy of the variables with their strings
+	// escaped for use in JSON strings.
+	jsonEscaped() chatVars
+}
+
+// chatTemplate is a template that renders to a chat component, such as a
+// message or a MOTD. Templates written as a JSON object or array are
+// rendered with their variables escaped for JSON, and used as a chat
+// component. Anything else is used as plain text. Values provided by
+// clients, such as the address they connected with, can't add
+// components of their own either way.
+type chatTemplate struct {
+	tmpl *template.Template
+
+	// json is set if the template is written as a JSON chat component.
+	json bool
+}
+
+// parseChatTemplate parses the provided chat template.
+func parseChatTemplate(name, text string) (*chatTemplate, error) {
+	tmpl, err := template.New(name).Funcs(statusTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether the template is JSON is decided by its text, without its
+	// actions, rather than by its output, which variables may change.
+	literal := strings.TrimSpace(templateActions.ReplaceAllString(text, ""))
+	isJSON := strings.HasPrefix(literal, "{") || strings.HasPrefix(literal, "[")
+
+	return &chatTemplate{tmpl: tmpl, json: isJSON}, nil
+}
+
+// render renders the template with the provided variables. If the
+// output of a JSON template isn't a valid chat component, it's returned
+// as plain text along with the error.
+func (t *chatTemplate) render(vars chatVars) (*minecraft.Chat, error) {
+	if t.json {
+		vars = vars.jsonEscaped()
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, vars); err != nil {
+		return nil, err
+	}
+
+	if !t.json {
+		return &minecraft.Chat{Text: b.String()}, nil
+	}
+
+	c, err := minecraft.ParseChat(b.String())
+	if err != nil {
+		return &minecraft.Chat{Text: b.String()}, errors.Wrap(err, "failed to parse chat component")
+	}
+	return c, nil
+}
+
+// jsonEscape escapes the provided string for use in a JSON string.
+func jsonEscape(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+
+	// Strip the quotes around the string.
+	return string(b[1 : len(b)-1])
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"charm.land/log/v2"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+)
+
+func TestChatTemplate(t *testing.T) {
+	// injection is an address trying to add components of its own.
+	const injection = `x", "extra": [{"text": "evil", "clickEvent": {"action": "open_url", "value": "https://example.com"}}], "y": "`
+
+	tests := []struct {
+		name     string
+		template string
+		vars     *messageVars
+		want     *minecraft.Chat
+	}{
+		{
+			name:     "plain text",
+			template: "§cUnknown server: {{ .Address }}",
+			vars:     &messageVars{Address: "mc.example.com"},
+			want:     &minecraft.Chat{Text: "§cUnknown server: mc.example.com"},
+		},
+		{
+			name:     "JSON",
+			template: `{"text": "Unknown server: {{ .Address }}", "color": "red"}`,
+			vars:     &messageVars{Address: "mc.example.com"},
+			want:     &minecraft.Chat{Text: "Unknown server: mc.example.com", Color: "red"},
+		},
+		{
+			name:     "JSON starting with an action",
+			template: `{{ if .Player }}{"text": "Hi {{ .Player }}"}{{ else }}{"text": "Hi"}{{ end }}`,
+			vars:     &messageVars{Player: "Notch"},
+			want:     &minecraft.Chat{Text: "Hi Notch"},
+		},
+		{
+			name:     "JSON with injected components",
+			template: `{"text": "Unknown server: {{ .Address }}"}`,
+			vars:     &messageVars{Address: injection},
+			want:     &minecraft.Chat{Text: "Unknown server: " + injection},
+		},
+		{
+			name:     "JSON with injected captures",
+			template: `{"text": "{{ .Captures.world }}"}`,
+			vars:     &messageVars{Captures: map[string]string{"world": `"}`}},
+			want:     &minecraft.Chat{Text: `"}`},
+		},
+		{
+			name:     "plain text rendering to JSON",
+			template: "{{ .Address }}",
+			vars:     &messageVars{Address: `{"text": "evil"}`},
+			want:     &minecraft.Chat{Text: `{"text": "evil"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseChatTemplate("test", tt.template)
+			if err != nil {
+				t.Fatalf("parseChatTemplate() error = %v", err)
+			}
+
+			got, err := tmpl.render(tt.vars)
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("render() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageCatalogRenderInvalidJSON(t *testing.T) {
+	m, err := newMessageCatalog(log.New(io.Discard), map[string]string{"starting": `{"text": `})
+	if err != nil {
+		t.Fatalf("newMessageCatalog() error = %v", err)
+	}
+
+	// Broken messages are sent as plain text, rather than not at all.
+	if got := m.render("starting", &messageVars{}); got.Text != `{"text": ` {
+		t.Errorf("render() = %+v, want the message as plain text", got)
+	}
+}
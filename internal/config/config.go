@@ -19,11 +19,18 @@ package config
 import (
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/minecraft"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/proxyproto"
+	"go.rgst.io/idlerealm/minecraft-preempt/v4/internal/schedule"
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,21 +43,306 @@ var (
 // Cloud is a cloud provider.
 type Cloud string
 
+// This block contains all of the valid forwarding modes.
+var (
+	ForwardingNone       Forwarding
+	ForwardingBungeeCord Forwarding = "bungeecord"
+	ForwardingVelocity   Forwarding = "velocity"
+)
+
+// Forwarding is a mode for forwarding the original client's address and
+// identity to a remote server.
+type Forwarding string
+
+// Contains the keys of all messages in the message catalog.
+const (
+	// MessageUnknownServer is sent to clients connecting with a
+	// hostname that doesn't route to any server.
+	MessageUnknownServer = "unknownServer"
+
+	// MessageNotWhitelisted is sent to players that aren't on the
+	// server's whitelist.
+	MessageNotWhitelisted = "notWhitelisted"
+
+	// MessageNotAuthenticated is sent to players that the session
+	// server doesn't know of, when the proxy authenticates players, see
+	// MinecraftServerConfig.Authenticate.
+	MessageNotAuthenticated = "notAuthenticated"
+
+	// MessageStarting is sent to players when the server is being
+	// started.
+	MessageStarting = "starting"
+
+	// MessageStartTimeout is sent to held, or parked, players
+	// when the server doesn't start in time.
+	MessageStartTimeout = "startTimeout"
+
+	// MessageStarted is sent to parked players that can't be
+	// transferred once the server has started.
+	MessageStarted = "started"
+
+	// MessageParked is shown, in a boss bar, to players parked in a
+	// world while the server is being started, see ParkConfig.
+	MessageParked = "parked"
+
+	// MessageDraining is sent to players logging in while the server is
+	// draining and, if RCON is configured, broadcast to online players
+	// when draining starts.
+	MessageDraining = "draining"
+
+	// MessageDrainKick is sent, through RCON, to players still online
+	// when the drain timeout is reached.
+	MessageDrainKick = "drainKick"
+
+	// MessageRateLimited is sent to players that connect, or log in,
+	// too often.
+	MessageRateLimited = "rateLimited"
+
+	// MessageTooManyConnections is sent to players connecting from an
+	// IP that has too many connections open.
+	MessageTooManyConnections = "tooManyConnections"
+
+	// MessageServerFull is sent to players logging in to a server that
+	// has too many players.
+	MessageServerFull = "serverFull"
+
+	// MessageFailed is sent to players logging in to a server that
+	// failed to start, until an operator resets it.
+	MessageFailed = "failed"
+
+	// MessageBlackout is sent to players logging in to a stopped server
+	// during a blackout window, when it isn't started.
+	MessageBlackout = "blackout"
+)
+
+// MessageKeys contains all valid message keys.
+var MessageKeys = []string{
+	MessageUnknownServer,
+	MessageNotWhitelisted,
+	MessageNotAuthenticated,
+	MessageStarting,
+	MessageStartTimeout,
+	MessageStarted,
+	MessageParked,
+	MessageDraining,
+	MessageDrainKick,
+	MessageRateLimited,
+	MessageTooManyConnections,
+	MessageServerFull,
+	MessageFailed,
+	MessageBlackout,
+}
+
+// DefaultLanguage is the language used if none is configured.
+const DefaultLanguage = "en"
+
+// Messages maps message keys, see MessageKeys, to message templates.
+//
+// Messages are Go templates, see https://pkg.go.dev/text/template.
+// Templates written as a JSON object or array are used as a chat
+// component, with variables escaped for use in its strings. Anything
+// else is plain text, in which legacy § formatting codes may be used.
+type Messages map[string]string
+
 // ProxyConfig is a configuration file for the proxy.
 type ProxyConfig struct {
-	// ListenAddress is the address the proxy should listen on.
+	// ListenAddress is the address the proxy should listen on. Ignored
+	// if Listeners is set.
 	ListenAddress string `yaml:"listenAddress"`
 
+	// ProxyProtocol is the PROXY protocol configuration for the
+	// listener. Ignored if Listeners is set.
+	ProxyProtocol ProxyProtocolConfig `yaml:"proxyProtocol"`
+
+	// Listeners are the listeners the proxy should accept connections
+	// on. If empty, a single listener is created from ListenAddress and
+	// ProxyProtocol.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// AdminAddress is the address to serve the admin HTTP endpoint on.
+	// Metrics are exposed at /debug/vars. If empty, the admin endpoint
+	// is disabled. Addresses other than loopback ones require
+	// AdminToken to be set.
+	AdminAddress string `yaml:"adminAddress"`
+
+	// AdminToken is the bearer token requests to the admin endpoint must
+	// provide in their Authorization header. If empty, requests aren't
+	// authenticated.
+	AdminToken string `yaml:"adminToken"`
+
+	// HandshakeTimeout is the maximum amount of time a client has to
+	// send its handshake after connecting.
+	//
+	// Defaults to 5 seconds.
+	HandshakeTimeout time.Duration `yaml:"handshakeTimeout"`
+
+	// MaxPendingHandshakes is the maximum number of connections that
+	// can be waiting to send their handshake at once. Connections past
+	// this limit are dropped.
+	//
+	// Defaults to 256.
+	MaxPendingHandshakes int `yaml:"maxPendingHandshakes"`
+
+	// Drain is the configuration block for draining connections, when
+	// the proxy is stopped or a server is drained.
+	Drain DrainConfig `yaml:"drain"`
+
+	// RateLimit is the configuration block for limiting connections per
+	// source IP.
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+
+	// Language is the language of messages sent to players, used for
+	// servers that don't set one.
+	//
+	// Defaults to "en".
+	Language string `yaml:"language"`
+
+	// Messages is the message catalog, mapping languages to messages.
+	// Messages that aren't set fall back to the built-in English ones.
+	Messages map[string]Messages `yaml:"messages"`
+
+	// StateDir is the directory to persist the state of servers in,
+	// such as the last status received from them, so it survives
+	// restarts of the proxy. If empty, state isn't persisted.
+	StateDir string `yaml:"stateDir"`
+
 	// Servers contains a list of all servers to proxy
 	Servers []ServerConfig `yaml:"servers"`
 }
 
+// DrainConfig is the configuration block for draining connections.
+type DrainConfig struct {
+	// Timeout is the maximum amount of time to wait for players to
+	// leave before they're disconnected.
+	//
+	// Defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// RateLimitConfig is the configuration block for limiting connections
+// per source IP. Limits are disabled by default.
+type RateLimitConfig struct {
+	// Connections limits new connections.
+	Connections RateLimit `yaml:"connections"`
+
+	// Status limits status requests, including legacy pings.
+	Status RateLimit `yaml:"status"`
+
+	// Login limits login attempts.
+	Login RateLimit `yaml:"login"`
+
+	// MaxConnectionsPerIP is the maximum number of connections a single
+	// IP can have open at once. If 0, there's no limit.
+	MaxConnectionsPerIP int `yaml:"maxConnectionsPerIP"`
+}
+
+// RateLimit is a token bucket rate limit, applied per source IP and per
+// source network (/24 for IPv4, /64 for IPv6).
+type RateLimit struct {
+	// Rate is the number of events allowed per second from a single IP.
+	// If 0, there's no limit.
+	Rate float64 `yaml:"rate"`
+
+	// Burst is the number of events allowed at once from a single IP.
+	//
+	// Defaults to Rate, rounded up.
+	Burst int `yaml:"burst"`
+
+	// NetworkRate is the number of events allowed per second from a
+	// single network. If 0, there's no limit.
+	NetworkRate float64 `yaml:"networkRate"`
+
+	// NetworkBurst is the number of events allowed at once from a single
+	// network.
+	//
+	// Defaults to NetworkRate, rounded up.
+	NetworkBurst int `yaml:"networkBurst"`
+}
+
+// ListenerConfig is the configuration block for a listener.
+type ListenerConfig struct {
+	// Address is the address to listen on, e.g. "0.0.0.0:25565" or
+	// "[::]:25565".
+	Address string `yaml:"address"`
+
+	// ProxyProtocol is the PROXY protocol configuration for the
+	// listener.
+	ProxyProtocol ProxyProtocolConfig `yaml:"proxyProtocol"`
+}
+
+// ProxyProtocolConfig is the configuration block for accepting the
+// HAProxy PROXY protocol on a listener.
+type ProxyProtocolConfig struct {
+	// Enabled, when true, requires connections from trusted sources to
+	// start with a PROXY protocol (v1 or v2) header. The address in the
+	// header is used as the client's address.
+	Enabled bool `yaml:"enabled"`
+
+	// TrustedCIDRs is a list of networks, or addresses, that are allowed
+	// to send a PROXY protocol header. Connections from other sources
+	// are treated as direct connections. Required when enabled, since
+	// trusting everyone would let clients spoof their address.
+	TrustedCIDRs []string `yaml:"trustedCIDRs"`
+}
+
+// TrustedNetworks returns the parsed TrustedCIDRs.
+func (c *ProxyProtocolConfig) TrustedNetworks() ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(c.TrustedCIDRs))
+	for _, cidr := range c.TrustedCIDRs {
+		// Support plain addresses as a single host network.
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted address %q", cidr)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted CIDR %q: %w", cidr, err)
+		}
+		networks = append(networks, n)
+	}
+
+	return networks, nil
+}
+
 // ServerConfig is a configuration block for a server
 type ServerConfig struct {
 	// Hostname is the hostname of the server. This should be the value
 	// that clients connect to through the Minecraft launcher.
 	Hostname string `yaml:"hostname"`
 
+	// Hostnames are additional hostnames for the server. Hostnames are
+	// matched case-insensitively and may be one of:
+	//
+	//   - an exact hostname, e.g. "mc.example.com", optionally with the
+	//     port the client connected to, e.g. "mc.example.com:25566"
+	//   - a wildcard, e.g. "*.mc.example.com", matching any subdomain
+	//   - a regular expression prefixed with "~", e.g.
+	//     "~(?P<world>[a-z]+)\.mc\.example\.com", which must match the
+	//     whole hostname. Named captures are made available to messages.
+	Hostnames []string `yaml:"hostnames"`
+
+	// Ports restricts the server to connections accepted by listeners
+	// on these ports. If empty, the server is available on all
+	// listeners.
+	Ports []int `yaml:"ports"`
+
+	// Default, when true, routes connections that don't match any
+	// other server to this server. If Ports is set, the server is only
+	// the default for those ports. Only one server may be the default
+	// for a port.
+	Default bool `yaml:"default"`
+
 	// ShutdownAfter is the amount of time to wait before
 	// shutting down the server after the last connection
 	// is closed.
@@ -58,6 +350,31 @@ type ServerConfig struct {
 	// Defaults to 15 minutes.
 	ShutdownAfter time.Duration `yaml:"shutdownAfter"`
 
+	// StartTimeout is the maximum amount of time the server may take to
+	// become ready after being started by the proxy.
+	//
+	// Defaults to 10 minutes.
+	StartTimeout time.Duration `yaml:"startTimeout"`
+
+	// StopTimeout is the maximum amount of time the server may take to
+	// stop. Once it's reached, the server is stopped again.
+	//
+	// Defaults to 5 minutes.
+	StopTimeout time.Duration `yaml:"stopTimeout"`
+
+	// Retry is the configuration block for retrying starts that fail,
+	// or time out.
+	Retry RetryConfig `yaml:"retry"`
+
+	// Preemption is the configuration block for recovering the server
+	// when it's stopped without the proxy stopping it, e.g. when a spot
+	// instance is preempted.
+	Preemption PreemptionConfig `yaml:"preemption"`
+
+	// Schedule is the configuration block for starting the server, and
+	// keeping it running, at scheduled times.
+	Schedule ScheduleConfig `yaml:"schedule"`
+
 	// GCP is the GCP configuration block.
 	GCP *GCPConfig `yaml:"gcp"`
 
@@ -67,9 +384,167 @@ type ServerConfig struct {
 	// Minecraft is the Minecraft configuration block.
 	Minecraft MinecraftServerConfig `yaml:"minecraft"`
 
-	// Whitelist is a list of usernames to whitelist. If empty,
-	// all users are allowed.
+	// Whitelist is a list of usernames, or UUIDs, to whitelist. UUIDs
+	// only match players the proxy authenticated, see
+	// MinecraftServerConfig.Authenticate. If empty, all users are
+	// allowed.
 	Whitelist []string `yaml:"whitelist"`
+
+	// MaxPlayers is the maximum number of players that can be connected
+	// to the server through the proxy at once. If 0, there's no limit.
+	MaxPlayers int `yaml:"maxPlayers"`
+
+	// Hold is the configuration block for holding login connections
+	// open while the server is being started.
+	Hold HoldConfig `yaml:"hold"`
+
+	// Park is the configuration block for parking players
+	// while the server is being started.
+	Park ParkConfig `yaml:"park"`
+
+	// Status is the configuration block for the server list entry shown
+	// while the server isn't running.
+	Status StatusConfig `yaml:"status"`
+
+	// Language is the language, from the message catalog, of messages
+	// sent to players of this server. Defaults to the proxy's language.
+	Language string `yaml:"language"`
+
+	// Messages overrides messages from the message catalog for this
+	// server.
+	Messages Messages `yaml:"messages"`
+}
+
+// RetryConfig is the configuration block for retrying failed starts.
+type RetryConfig struct {
+	// Attempts is the number of times to try starting the server before
+	// marking it failed. Servers that time out are stopped before being
+	// started again.
+	//
+	// Defaults to 1, which doesn't retry.
+	Attempts int `yaml:"attempts"`
+
+	// Backoff is the amount of time to wait before the first retry,
+	// doubling for every retry after it.
+	//
+	// Defaults to 30 seconds.
+	Backoff time.Duration `yaml:"backoff"`
+
+	// MaxBackoff is the maximum amount of time to wait between retries.
+	//
+	// Defaults to 10 minutes.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// PreemptionConfig is the configuration block for recovering a server
+// that stopped unexpectedly.
+type PreemptionConfig struct {
+	// Restart, when true, starts the server again once it's stopped
+	// unexpectedly.
+	Restart bool `yaml:"restart"`
+
+	// Retry is the configuration block for retrying restarts that fail,
+	// or time out. Once all attempts failed, the server is left stopped
+	// until a player joins.
+	//
+	// Defaults to 5 attempts, with a backoff of 1 minute up to 15
+	// minutes.
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// ScheduleConfig is the configuration block for a server's schedule.
+type ScheduleConfig struct {
+	// TimeZone is the IANA time zone the schedule's cron expressions are
+	// evaluated in, e.g. "Europe/Berlin".
+	//
+	// Defaults to UTC.
+	TimeZone string `yaml:"timezone"`
+
+	// Prewarm contains the windows to start the server ahead of players
+	// joining in. The server is kept running until the window ends.
+	Prewarm []WindowConfig `yaml:"prewarm"`
+
+	// KeepAlive contains the windows during which a running server isn't
+	// stopped for being empty.
+	KeepAlive []WindowConfig `yaml:"keepAlive"`
+
+	// Blackout is the configuration block for windows during which the
+	// server isn't started.
+	Blackout BlackoutConfig `yaml:"blackout"`
+}
+
+// BlackoutConfig is the configuration block for a server's blackout
+// windows.
+type BlackoutConfig struct {
+	// Windows contains the windows during which the server isn't
+	// started. Blackouts take precedence over prewarm windows.
+	Windows []WindowConfig `yaml:"windows"`
+
+	// Stop, when true, drains and stops a running server when a blackout
+	// begins.
+	Stop bool `yaml:"stop"`
+
+	// DrainTimeout is how long players are given to leave before the
+	// server is stopped for a blackout.
+	//
+	// Defaults to 5 minutes.
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+}
+
+// Location returns the time zone of the schedule.
+func (c *ScheduleConfig) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(c.TimeZone)
+}
+
+// WindowConfig is the configuration block for a recurring window of
+// time.
+type WindowConfig struct {
+	// Cron is the cron expression the window starts at, e.g.
+	// "0 19 * * mon-fri".
+	Cron string `yaml:"cron"`
+
+	// Duration is how long the window lasts.
+	Duration time.Duration `yaml:"duration"`
+}
+
+// Window returns the parsed window.
+func (c *WindowConfig) Window() (*schedule.Window, error) {
+	s, err := schedule.Parse(c.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Duration <= 0 {
+		return nil, fmt.Errorf("window %q has no duration", c.Cron)
+	}
+
+	return &schedule.Window{Schedule: s, Duration: c.Duration}, nil
+}
+
+// HoldConfig is the configuration block for holding login connections
+// open while a server is being started.
+type HoldConfig struct {
+	// Enabled, when true, keeps a login connection open while the
+	// server is started instead of disconnecting the player. Once the
+	// server is up, the connection is proxied as normal.
+	Enabled bool `yaml:"enabled"`
+
+	// Timeout is the maximum amount of time to hold a connection open
+	// while waiting for the server to start. Note that most clients
+	// give up on their own after 30 seconds.
+	//
+	// Defaults to 25 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// PollInterval is how often the server is checked while a
+	// connection is being held.
+	//
+	// Defaults to 2 seconds.
+	PollInterval time.Duration `yaml:"pollInterval"`
 }
 
 // MinecraftServerConfig is the configuration block for a Minecraft
@@ -82,6 +557,151 @@ type MinecraftServerConfig struct {
 
 	// Port of the remote server, defaults to 25565.
 	Port uint `yaml:"port"`
+
+	// ReadyAfter is the number of consecutive successful status pings
+	// required before the server is considered ready to accept players.
+	// Until then, the server is treated as starting even if the cloud
+	// provider reports it as running.
+	//
+	// Defaults to 1.
+	ReadyAfter uint `yaml:"readyAfter"`
+
+	// Version is the Minecraft release the server runs, e.g. "1.20.4".
+	// It's shown, along with its protocol version, while the server is
+	// offline. If empty, the version of the last status received from
+	// the server is used.
+	Version string `yaml:"version"`
+
+	// RCON is the configuration block for the remote server's RCON
+	// interface. If set, it's used to notify and kick players when the
+	// server is drained.
+	RCON *RCONConfig `yaml:"rcon"`
+
+	// PingTimeout is the maximum amount of time to wait for the remote
+	// server to answer a status ping.
+	//
+	// Defaults to 5 seconds.
+	PingTimeout time.Duration `yaml:"pingTimeout"`
+
+	// StatusCacheTTL is how long a status ping of the remote server is
+	// reused for when answering status requests from clients.
+	//
+	// Defaults to 5 seconds.
+	StatusCacheTTL time.Duration `yaml:"statusCacheTTL"`
+
+	// ProxyProtocol is the version of the PROXY protocol header, "v1" or
+	// "v2", to send to the remote server before any other data. The
+	// header contains the original client's address. If empty, no
+	// header is sent.
+	ProxyProtocol string `yaml:"proxyProtocol"`
+
+	// Forwarding is how the original client's address and UUID are
+	// forwarded to the remote server. Supported values are "bungeecord"
+	// (legacy IP forwarding, requires `bungeecord: true` in spigot.yml)
+	// and "velocity" (modern forwarding, requires ForwardingSecret).
+	// Offline mode UUIDs are forwarded, unless Authenticate is set. The
+	// remote server must run in offline mode and only be reachable by
+	// the proxy. If empty, nothing is forwarded.
+	Forwarding Forwarding `yaml:"forwarding"`
+
+	// ForwardingSecret is the secret shared with the remote server, used
+	// to sign forwarded information when using Velocity's modern
+	// forwarding.
+	ForwardingSecret string `yaml:"forwardingSecret"`
+
+	// Authenticate makes the proxy authenticate players with Mojang's
+	// session server, like a server in online mode, and forward their
+	// verified profile instead of an offline mode UUID. Requires
+	// Forwarding.
+	Authenticate bool `yaml:"authenticate"`
+}
+
+// ParkConfig is the configuration block for parking players while a
+// server is being started. Parked players are logged in by the proxy
+// itself and, for 1.20.2 to 1.20.4 clients, spawned in an empty world
+// with a boss bar showing the server's progress, see MessageParked.
+// Newer clients are kept on the joining screen, in the configuration
+// state, without a world. Once the server is ready, the player is
+// transferred back to the proxy (1.20.5+) or asked to reconnect.
+//
+// Parking requires 1.20.2+ clients, older clients fall back to the hold
+// configuration.
+type ParkConfig struct {
+	// Enabled, when true, parks players while the server is being
+	// started.
+	Enabled bool `yaml:"enabled"`
+
+	// Timeout is the maximum amount of time to keep a player parked
+	// while waiting for the server to start.
+	//
+	// Defaults to 5 minutes.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// PollInterval is how often the server is checked while a player
+	// is parked.
+	//
+	// Defaults to 2 seconds.
+	PollInterval time.Duration `yaml:"pollInterval"`
+}
+
+// StatusConfig is the configuration block for the server list entry
+// shown while a server isn't running, or isn't ready yet.
+//
+// MOTDs and the version label are Go templates, see
+// https://pkg.go.dev/text/template. MOTDs written as a JSON object or
+// array are used as a chat component, with variables escaped for use in
+// its strings. Anything else is plain text, in which legacy § formatting
+// codes may be used.
+type StatusConfig struct {
+	// MOTD contains the MOTD templates for each state of the server.
+	MOTD MOTDConfig `yaml:"motd"`
+
+	// Favicon is the path to a 64x64 PNG file to show as the server's
+	// icon. If empty, the icon of the last status received from the
+	// server is used.
+	Favicon string `yaml:"favicon"`
+
+	// VersionLabel is a template for the version name, e.g. "Sleeping –
+	// join to wake". When set, the protocol version is reported as -1 so
+	// that clients always show it, marking the server as incompatible.
+	// If empty, the version of the last status received from the server
+	// is used.
+	VersionLabel string `yaml:"versionLabel"`
+}
+
+// MOTDConfig contains the MOTD templates for each state of a server. If
+// a template is empty, the Unknown template is used. If that's empty as
+// well, a MOTD containing the state is used, or the MOTD of the last
+// status received from the server if it's stopped or its state is
+// unknown.
+type MOTDConfig struct {
+	// Stopped is the MOTD shown while the server is stopped.
+	Stopped string `yaml:"stopped"`
+
+	// Starting is the MOTD shown while the server is starting, or is
+	// running but not ready yet.
+	Starting string `yaml:"starting"`
+
+	// Stopping is the MOTD shown while the server is stopping.
+	Stopping string `yaml:"stopping"`
+
+	// Unknown is the MOTD shown while the state of the server is
+	// unknown.
+	Unknown string `yaml:"unknown"`
+
+	// Failed is the MOTD shown while the server is marked failed, after
+	// failing to start.
+	Failed string `yaml:"failed"`
+}
+
+// RCONConfig is the configuration block for a Minecraft server's RCON
+// interface. The hostname of the Minecraft server is used.
+type RCONConfig struct {
+	// Port is the RCON port, defaults to 25575.
+	Port uint `yaml:"port"`
+
+	// Password is the RCON password.
+	Password string `yaml:"password"`
 }
 
 // GCPConfig is a configuration block for GCP
@@ -110,40 +730,474 @@ func applyDefaults(conf *ProxyConfig) {
 		conf.ListenAddress = "0.0.0.0:25565"
 	}
 
+	if len(conf.Listeners) == 0 {
+		conf.Listeners = []ListenerConfig{{
+			Address:       conf.ListenAddress,
+			ProxyProtocol: conf.ProxyProtocol,
+		}}
+	}
+
+	if conf.HandshakeTimeout == 0 {
+		// Default to 5 seconds
+		conf.HandshakeTimeout = 5 * time.Second
+	}
+
+	if conf.MaxPendingHandshakes == 0 {
+		// Default to 256
+		conf.MaxPendingHandshakes = 256
+	}
+
+	if conf.Language == "" {
+		conf.Language = DefaultLanguage
+	}
+
+	applyRateLimitDefaults(&conf.RateLimit)
+
+	if conf.Drain.Timeout == 0 {
+		// Default to 30 seconds
+		conf.Drain.Timeout = 30 * time.Second
+	}
+
 	for i := range conf.Servers {
-		if conf.Servers[i].ShutdownAfter == 0 {
-			// Default to 15 minutes
-			conf.Servers[i].ShutdownAfter = 15 * time.Minute
+		applyServerDefaults(&conf.Servers[i], conf.Language)
+	}
+}
+
+// applyRateLimitDefaults applies default values to the rate limits.
+func applyRateLimitDefaults(conf *RateLimitConfig) {
+	for _, rl := range []*RateLimit{&conf.Connections, &conf.Status, &conf.Login} {
+		if rl.Burst == 0 {
+			// Default to the rate, rounded up
+			rl.Burst = int(math.Ceil(rl.Rate))
 		}
 
-		if conf.Servers[i].Minecraft.Port == 0 {
-			// Default to 25565
-			conf.Servers[i].Minecraft.Port = 25565
+		if rl.NetworkBurst == 0 {
+			// Default to the network rate, rounded up
+			rl.NetworkBurst = int(math.Ceil(rl.NetworkRate))
 		}
 	}
 }
 
+// applyServerDefaults applies default values to a server's
+// configuration. language is the proxy's language.
+func applyServerDefaults(s *ServerConfig, language string) {
+	if s.Language == "" {
+		s.Language = language
+	}
+
+	if s.ShutdownAfter == 0 {
+		// Default to 15 minutes
+		s.ShutdownAfter = 15 * time.Minute
+	}
+
+	if s.Schedule.Blackout.DrainTimeout == 0 {
+		// Default to 5 minutes
+		s.Schedule.Blackout.DrainTimeout = 5 * time.Minute
+	}
+
+	if s.Hold.Timeout == 0 {
+		// Default to 25 seconds
+		s.Hold.Timeout = 25 * time.Second
+	}
+
+	if s.Hold.PollInterval == 0 {
+		// Default to 2 seconds
+		s.Hold.PollInterval = 2 * time.Second
+	}
+
+	if s.Park.Timeout == 0 {
+		// Default to 5 minutes
+		s.Park.Timeout = 5 * time.Minute
+	}
+
+	if s.Park.PollInterval == 0 {
+		// Default to 2 seconds
+		s.Park.PollInterval = 2 * time.Second
+	}
+
+	applyLifecycleDefaults(s)
+	applyMinecraftDefaults(&s.Minecraft)
+}
+
+// applyLifecycleDefaults applies default values to a server's timeouts
+// and retries.
+func applyLifecycleDefaults(s *ServerConfig) {
+	if s.StartTimeout == 0 {
+		// Default to 10 minutes
+		s.StartTimeout = 10 * time.Minute
+	}
+
+	if s.StopTimeout == 0 {
+		// Default to 5 minutes
+		s.StopTimeout = 5 * time.Minute
+	}
+
+	if s.Retry.Attempts == 0 {
+		// Default to 1
+		s.Retry.Attempts = 1
+	}
+
+	if s.Retry.Backoff == 0 {
+		// Default to 30 seconds
+		s.Retry.Backoff = 30 * time.Second
+	}
+
+	if s.Retry.MaxBackoff == 0 {
+		// Default to 10 minutes
+		s.Retry.MaxBackoff = 10 * time.Minute
+	}
+
+	if s.Preemption.Retry.Attempts == 0 {
+		// Default to 5
+		s.Preemption.Retry.Attempts = 5
+	}
+
+	if s.Preemption.Retry.Backoff == 0 {
+		// Default to 1 minute
+		s.Preemption.Retry.Backoff = time.Minute
+	}
+
+	if s.Preemption.Retry.MaxBackoff == 0 {
+		// Default to 15 minutes
+		s.Preemption.Retry.MaxBackoff = 15 * time.Minute
+	}
+}
+
+// applyMinecraftDefaults applies default values to a server's Minecraft
+// configuration.
+func applyMinecraftDefaults(mc *MinecraftServerConfig) {
+	if mc.Port == 0 {
+		// Default to 25565
+		mc.Port = 25565
+	}
+
+	if mc.ReadyAfter == 0 {
+		// Default to 1
+		mc.ReadyAfter = 1
+	}
+
+	if mc.RCON != nil && mc.RCON.Port == 0 {
+		// Default to 25575
+		mc.RCON.Port = 25575
+	}
+
+	if mc.PingTimeout == 0 {
+		// Default to 5 seconds
+		mc.PingTimeout = 5 * time.Second
+	}
+
+	if mc.StatusCacheTTL == 0 {
+		// Default to 5 seconds
+		mc.StatusCacheTTL = 5 * time.Second
+	}
+}
+
 // validateConfig validates the configuration is valid.
 func validateConfig(conf *ProxyConfig) error {
 	if len(conf.Servers) == 0 {
 		return fmt.Errorf("no servers defined")
 	}
 
-	for i, s := range conf.Servers {
-		if s.Hostname == "" {
-			return fmt.Errorf("server %d has no hostname", i)
+	if err := validateListeners(conf.Listeners); err != nil {
+		return err
+	}
+
+	if err := validateAdmin(conf); err != nil {
+		return err
+	}
+
+	if conf.HandshakeTimeout < 0 {
+		return fmt.Errorf("handshakeTimeout must not be negative")
+	}
+
+	if conf.MaxPendingHandshakes < 0 {
+		return fmt.Errorf("maxPendingHandshakes must not be negative")
+	}
+
+	for lang, messages := range conf.Messages {
+		if err := messages.validate(); err != nil {
+			return errors.Wrapf(err, "invalid messages for language %q", lang)
+		}
+	}
+
+	if err := validateLanguage(conf, conf.Language); err != nil {
+		return err
+	}
+
+	if err := validateRateLimits(&conf.RateLimit); err != nil {
+		return err
+	}
+
+	for i := range conf.Servers {
+		if err := validateServer(conf, i, &conf.Servers[i]); err != nil {
+			return err
+		}
+	}
+
+	return validateDefaultServers(conf.Servers)
+}
+
+// validateListeners ensures the listeners are valid.
+func validateListeners(listeners []ListenerConfig) error {
+	for i, l := range listeners {
+		if l.Address == "" {
+			return fmt.Errorf("listener %d has no address", i)
+		}
+
+		if _, err := l.ProxyProtocol.TrustedNetworks(); err != nil {
+			return errors.Wrapf(err, "listener %q has invalid proxyProtocol config", l.Address)
+		}
+
+		if l.ProxyProtocol.Enabled && len(l.ProxyProtocol.TrustedCIDRs) == 0 {
+			return fmt.Errorf("listener %q has proxyProtocol enabled without any trustedCIDRs", l.Address)
 		}
+	}
+
+	return nil
+}
+
+// validateAdmin ensures the admin endpoint, which can stop and drain
+// servers, isn't reachable by anyone without a token.
+func validateAdmin(conf *ProxyConfig) error {
+	if conf.AdminAddress == "" || conf.AdminToken != "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(conf.AdminAddress)
+	if err != nil {
+		return errors.Wrapf(err, "invalid adminAddress %q", conf.AdminAddress)
+	}
 
-		if s.GCP != nil && s.Docker != nil {
-			return fmt.Errorf("server %q has both gcp and docker config", s.Hostname)
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("adminAddress %q isn't a loopback address, adminToken is required", conf.AdminAddress)
+}
+
+// validateRateLimits ensures none of the rate limits are negative.
+func validateRateLimits(conf *RateLimitConfig) error {
+	for name, rl := range map[string]*RateLimit{
+		"connections": &conf.Connections,
+		"status":      &conf.Status,
+		"login":       &conf.Login,
+	} {
+		if rl.Rate < 0 || rl.Burst < 0 || rl.NetworkRate < 0 || rl.NetworkBurst < 0 {
+			return fmt.Errorf("rateLimit.%s must not be negative", name)
 		}
+	}
+
+	if conf.MaxConnectionsPerIP < 0 {
+		return fmt.Errorf("rateLimit.maxConnectionsPerIP must not be negative")
+	}
+
+	return nil
+}
 
-		if s.GCP == nil && s.Docker == nil {
-			return fmt.Errorf("server %q has no gcp or docker config", s.Hostname)
+// validateDefaultServers ensures there's at most one default server for
+// each port.
+func validateDefaultServers(servers []ServerConfig) error {
+	// defaultServers tracks the default server for each port, with 0
+	// being the default for all ports.
+	defaultServers := make(map[int]string)
+	for _, s := range servers {
+		if !s.Default {
+			continue
 		}
 
-		if s.Minecraft.Hostname == "" {
-			return fmt.Errorf("server %q has no configured minecraft hostname", s.Hostname)
+		ports := s.Ports
+		if len(ports) == 0 {
+			ports = []int{0}
+		}
+
+		for _, port := range ports {
+			if existing, ok := defaultServers[port]; ok {
+				return fmt.Errorf("server %q and %q are both the default server", existing, s.Hostname)
+			}
+			defaultServers[port] = s.Hostname
+		}
+	}
+
+	return nil
+}
+
+// validateServer ensures the server at index i of the proxy
+// configuration is valid.
+func validateServer(conf *ProxyConfig, i int, s *ServerConfig) error {
+	if s.Hostname == "" {
+		return fmt.Errorf("server %d has no hostname", i)
+	}
+
+	for _, hostname := range append([]string{s.Hostname}, s.Hostnames...) {
+		if err := validateHostname(hostname); err != nil {
+			return fmt.Errorf("server %q has invalid hostname %q: %w", s.Hostname, hostname, err)
+		}
+	}
+
+	for _, port := range s.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("server %q has invalid port %d", s.Hostname, port)
+		}
+	}
+
+	if s.MaxPlayers < 0 {
+		return fmt.Errorf("server %q has negative maxPlayers", s.Hostname)
+	}
+
+	if s.GCP != nil && s.Docker != nil {
+		return fmt.Errorf("server %q has both gcp and docker config", s.Hostname)
+	}
+
+	if s.GCP == nil && s.Docker == nil {
+		return fmt.Errorf("server %q has no gcp or docker config", s.Hostname)
+	}
+
+	if s.Hold.Timeout < 0 || s.Hold.PollInterval < 0 {
+		return fmt.Errorf("server %q has a negative hold setting", s.Hostname)
+	}
+
+	if s.Park.Timeout < 0 || s.Park.PollInterval < 0 {
+		return fmt.Errorf("server %q has a negative park setting", s.Hostname)
+	}
+
+	if err := validateLifecycle(s); err != nil {
+		return err
+	}
+
+	if err := validateSchedule(s); err != nil {
+		return err
+	}
+
+	if err := validateMinecraft(s); err != nil {
+		return err
+	}
+
+	if err := validateLanguage(conf, s.Language); err != nil {
+		return fmt.Errorf("server %q: %w", s.Hostname, err)
+	}
+
+	return errors.Wrapf(s.Messages.validate(), "server %q has invalid messages", s.Hostname)
+}
+
+// validateLifecycle ensures the server's timeouts and retries are
+// valid.
+func validateLifecycle(s *ServerConfig) error {
+	if s.StartTimeout < 0 || s.StopTimeout < 0 || s.Retry.Backoff < 0 || s.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("server %q has a negative timeout", s.Hostname)
+	}
+
+	if s.Retry.Attempts < 0 {
+		return fmt.Errorf("server %q has negative retry.attempts", s.Hostname)
+	}
+
+	if pr := s.Preemption.Retry; pr.Attempts < 0 || pr.Backoff < 0 || pr.MaxBackoff < 0 {
+		return fmt.Errorf("server %q has a negative preemption.retry setting", s.Hostname)
+	}
+
+	return nil
+}
+
+// validateSchedule ensures the server's schedule is valid.
+func validateSchedule(s *ServerConfig) error {
+	if _, err := s.Schedule.Location(); err != nil {
+		return errors.Wrapf(err, "server %q has invalid schedule.timezone", s.Hostname)
+	}
+
+	if s.Schedule.Blackout.DrainTimeout < 0 {
+		return fmt.Errorf("server %q has negative schedule.blackout.drainTimeout", s.Hostname)
+	}
+
+	for _, w := range slices.Concat(s.Schedule.Prewarm, s.Schedule.KeepAlive, s.Schedule.Blackout.Windows) {
+		if _, err := w.Window(); err != nil {
+			return errors.Wrapf(err, "server %q has invalid schedule", s.Hostname)
+		}
+	}
+
+	return nil
+}
+
+// validateMinecraft ensures the server's Minecraft configuration is
+// valid.
+func validateMinecraft(s *ServerConfig) error {
+	mc := &s.Minecraft
+	if mc.Hostname == "" {
+		return fmt.Errorf("server %q has no configured minecraft hostname", s.Hostname)
+	}
+
+	switch mc.Forwarding {
+	case ForwardingNone, ForwardingBungeeCord:
+	case ForwardingVelocity:
+		if mc.ForwardingSecret == "" {
+			return fmt.Errorf("server %q uses velocity forwarding but has no minecraft.forwardingSecret", s.Hostname)
+		}
+	default:
+		return fmt.Errorf("server %q has unknown minecraft.forwarding %q", s.Hostname, mc.Forwarding)
+	}
+
+	if mc.Authenticate && mc.Forwarding == ForwardingNone {
+		return fmt.Errorf("server %q has minecraft.authenticate but no minecraft.forwarding", s.Hostname)
+	}
+
+	if mc.RCON != nil && mc.RCON.Password == "" {
+		return fmt.Errorf("server %q has minecraft.rcon but no password", s.Hostname)
+	}
+
+	if mc.Version != "" {
+		if _, ok := minecraft.ProtocolForRelease(mc.Version); !ok {
+			return fmt.Errorf("server %q has unknown minecraft.version %q", s.Hostname, mc.Version)
+		}
+	}
+
+	if mc.ProxyProtocol != "" {
+		if _, err := proxyproto.ParseVersion(mc.ProxyProtocol); err != nil {
+			return fmt.Errorf("server %q has invalid minecraft.proxyProtocol: %w", s.Hostname, err)
+		}
+	}
+
+	return nil
+}
+
+// validate ensures all of the messages have a known key.
+func (m Messages) validate() error {
+	for key := range m {
+		if !slices.Contains(MessageKeys, key) {
+			return fmt.Errorf("unknown message %q", key)
+		}
+	}
+
+	return nil
+}
+
+// validateLanguage ensures the provided language is in the message
+// catalog. The default language is built-in, so it's always valid.
+func validateLanguage(conf *ProxyConfig, lang string) error {
+	if lang == DefaultLanguage {
+		return nil
+	}
+
+	if _, ok := conf.Messages[lang]; !ok {
+		return fmt.Errorf("language %q is not in the message catalog", lang)
+	}
+
+	return nil
+}
+
+// validateHostname validates a hostname pattern, see
+// ServerConfig.Hostnames.
+func validateHostname(hostname string) error {
+	switch {
+	case hostname == "":
+		return fmt.Errorf("hostname is empty")
+	case strings.HasPrefix(hostname, "~"):
+		if _, err := regexp.Compile(hostname[1:]); err != nil {
+			return err
+		}
+	case strings.Contains(hostname, "*"):
+		if !strings.HasPrefix(hostname, "*.") || strings.Count(hostname, "*") != 1 {
+			return fmt.Errorf("wildcards are only supported as the first label, e.g. *.example.com")
 		}
 	}
 
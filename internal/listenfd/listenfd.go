@@ -0,0 +1,281 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package listenfd implements inheriting listeners from systemd socket
+// activation, and handing them off to a new process for zero-downtime
+// restarts.
+//
+// See: https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+package listenfd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd, after
+// stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// readyFDEnv is the environment variable containing the file descriptor
+// a process started by Handoff reports it's ready on.
+const readyFDEnv = "MINECRAFT_PREEMPT_READY_FD"
+
+// handoffTimeout is how long Handoff waits for the new process to be
+// ready.
+const handoffTimeout = 30 * time.Second
+
+// Set is a set of listeners inherited from the parent process.
+type Set struct {
+	mu sync.Mutex
+
+	// listeners are the inherited listeners that haven't been used yet.
+	listeners []net.Listener
+
+	// ready is the pipe to report readiness to the parent process on,
+	// if started by Handoff.
+	ready *os.File
+}
+
+// Inherit returns the listeners passed to the process, either by systemd
+// socket activation or by Handoff. The environment variables used to pass
+// them are unset, so they aren't inherited by child processes.
+func Inherit() (*Set, error) {
+	s := &Set{}
+
+	if fd := os.Getenv(readyFDEnv); fd != "" {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", readyFDEnv, fd, err)
+		}
+		s.ready = os.NewFile(uintptr(n), "ready")
+	}
+
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", readyFDEnv} {
+		os.Unsetenv(env) //nolint:errcheck // Why: Best effort.
+	}
+
+	// The listeners are meant for another process, e.g. our parent.
+	if fds == "" || (pid != "" && pid != strconv.Itoa(os.Getpid())) {
+		return s, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: %w", fds, err)
+	}
+
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "listener-"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close() // FileListener duplicates the file descriptor.
+		if err != nil {
+			s.Close() //nolint:errcheck // Why: Already failing.
+			return nil, fmt.Errorf("failed to inherit file descriptor %d: %w", fd, err)
+		}
+
+		s.listeners = append(s.listeners, l)
+	}
+
+	return s, nil
+}
+
+// Listen returns the inherited TCP listener bound to the provided
+// address and removes it from the set. If there isn't one, a new
+// listener is created.
+func (s *Set) Listen(address string) (net.Listener, error) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, l := range s.listeners {
+		if matches(l.Addr(), addr) {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			return l, nil
+		}
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// matches returns true if the inherited listener address, bound, is the
+// configured address, want.
+func matches(bound net.Addr, want *net.TCPAddr) bool {
+	tcp, ok := bound.(*net.TCPAddr)
+	if !ok || want.Port == 0 || tcp.Port != want.Port {
+		return false
+	}
+
+	// A listener on the unspecified address, e.g. "[::]", may have been
+	// configured as "0.0.0.0" or ":port".
+	if want.IP == nil || want.IP.IsUnspecified() {
+		return tcp.IP == nil || tcp.IP.IsUnspecified()
+	}
+
+	return tcp.IP.Equal(want.IP)
+}
+
+// Ready reports that the process is ready to accept connections, to the
+// process that started it with Handoff and, if set, to systemd through
+// NOTIFY_SOCKET. The notification tells systemd this is now the service's
+// main process.
+func (s *Set) Ready() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready != nil {
+		_, err := s.ready.Write([]byte{1})
+		s.ready.Close()
+		s.ready = nil
+		if err != nil {
+			return fmt.Errorf("failed to report readiness to parent: %w", err)
+		}
+	}
+
+	return notify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+}
+
+// Close closes all inherited listeners that weren't used.
+func (s *Set) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+
+	return nil
+}
+
+// notify sends the provided state to systemd, if NOTIFY_SOCKET is set.
+func notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Handoff starts a new copy of the running binary, with the same
+// arguments, passing it the provided TCP listeners. It returns once the
+// new process has called Set.Ready, after which the caller should stop
+// accepting connections. If the new process fails to become ready, it's
+// killed and an error is returned.
+func Handoff(listeners []net.Listener) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, l := range listeners {
+		tl, ok := l.(*net.TCPListener)
+		if !ok {
+			return nil, fmt.Errorf("unsupported listener type %T", l)
+		}
+
+		f, err := tl.File()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file for listener %s: %w", l.Addr(), err)
+		}
+		files = append(files, f)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyR.Close()
+	files = append(files, readyW)
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "LISTEN_") && !strings.HasPrefix(e, readyFDEnv+"=") {
+			env = append(env, e)
+		}
+	}
+	env = append(env,
+		"LISTEN_FDS="+strconv.Itoa(len(listeners)),
+		readyFDEnv+"="+strconv.Itoa(listenFDsStart+len(listeners)),
+	)
+
+	//nolint:gosec // Why: Re-executing ourselves.
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	// Close our copies of the files, so reading from the pipe fails if
+	// the new process exits without being ready.
+	for _, f := range files {
+		f.Close()
+	}
+	files = nil
+
+	readyErr := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := readyR.Read(b)
+		readyErr <- err
+	}()
+
+	select {
+	case err = <-readyErr:
+	case <-time.After(handoffTimeout):
+		err = fmt.Errorf("timed out after %s", handoffTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck // Why: Best effort.
+		cmd.Wait()         //nolint:errcheck // Why: Only reaping the process.
+		return nil, fmt.Errorf("new process failed to become ready: %w", err)
+	}
+
+	// Reap the new process when it exits, it outlives us in the usual
+	// case.
+	go cmd.Wait() //nolint:errcheck // Why: Only reaping the process.
+
+	return cmd.Process, nil
+}
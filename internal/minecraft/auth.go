@@ -0,0 +1,358 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // Why: The session server digest is defined as SHA-1.
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Tnze/go-mc/net/CFB8"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Contains packet IDs used for authentication, which happens in the
+// login state.
+const (
+	// packetIDEncryptionRequest is the clientbound encryption request
+	// packet.
+	packetIDEncryptionRequest int32 = 0x01
+
+	// packetIDEncryptionResponse is the serverbound encryption response
+	// packet.
+	packetIDEncryptionResponse int32 = 0x01
+)
+
+// sessionServerURL is the endpoint of Mojang's session server that
+// returns the profile of a player that has joined a server.
+const sessionServerURL = "https://sessionserver.mojang.com/session/minecraft/hasJoined"
+
+// sessionServerTimeout is the timeout for requests to the session
+// server.
+const sessionServerTimeout = 10 * time.Second
+
+// verifyTokenLength is the length of the verify token sent to clients,
+// the same as the vanilla server's.
+const verifyTokenLength = 4
+
+// sharedSecretLength is the length of the shared secret clients encrypt
+// the connection with.
+const sharedSecretLength = 16
+
+// ErrNotAuthenticated is returned by Authenticate when the session
+// server doesn't know of the player joining, e.g. because the client
+// isn't logged in to a Minecraft account.
+var ErrNotAuthenticated = errors.New("player is not authenticated")
+
+// Profile is the profile of an authenticated player, as returned by the
+// session server.
+type Profile struct {
+	// ID is the UUID of the player.
+	ID uuid.UUID `json:"id"`
+
+	// Name is the name of the player.
+	Name string `json:"name"`
+
+	// Properties contains the player's properties, such as their skin.
+	Properties []ProfileProperty `json:"properties"`
+}
+
+// ProfileProperty is a property of a player's profile.
+type ProfileProperty struct {
+	// Name is the name of the property, e.g. "textures".
+	Name string `json:"name"`
+
+	// Value is the base64 encoded value of the property.
+	Value string `json:"value"`
+
+	// Signature is the base64 encoded signature of the value, made by
+	// Mojang. It's empty if the property isn't signed.
+	Signature string `json:"signature,omitempty"`
+}
+
+// propertyFields returns the fields encoding the provided properties
+// as a length prefixed array, like they're sent in login success and
+// forwarding packets.
+func propertyFields(props []ProfileProperty) []pk.FieldEncoder {
+	fields := []pk.FieldEncoder{pk.VarInt(len(props))}
+	for _, prop := range props {
+		fields = append(fields,
+			pk.String(prop.Name),
+			pk.String(prop.Value),
+			pk.Boolean(prop.Signature != ""),
+		)
+		if prop.Signature != "" {
+			fields = append(fields, pk.String(prop.Signature))
+		}
+	}
+	return fields
+}
+
+// Authenticator authenticates players with Mojang's session server,
+// like a server in online mode does.
+type Authenticator struct {
+	// key is the key clients encrypt the shared secret with.
+	key *rsa.PrivateKey
+
+	// publicKey is the DER encoded public key sent to clients.
+	publicKey []byte
+
+	// sessionServer is the URL of the session server's hasJoined
+	// endpoint.
+	sessionServer string
+
+	// client is the HTTP client used to talk to the session server.
+	client *http.Client
+}
+
+// NewAuthenticator creates an Authenticator with a newly generated
+// key.
+func NewAuthenticator() (*Authenticator, error) {
+	// Clients only accept 1024 bit keys.
+	key, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec // Why: Required by the protocol.
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate key")
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode public key")
+	}
+
+	return &Authenticator{
+		key:           key,
+		publicKey:     publicKey,
+		sessionServer: sessionServerURL,
+		client:        &http.Client{Timeout: sessionServerTimeout},
+	}, nil
+}
+
+// Authenticate authenticates the player that sent the provided login
+// start packet, returning their profile. This enables encryption on the
+// connection, everything written to, or read from, the client
+// afterwards is encrypted. ErrNotAuthenticated is returned if the
+// session server doesn't know of the player.
+//
+// See: https://wiki.vg/Protocol_Encryption
+func (c *Client) Authenticate(ctx context.Context, a *Authenticator, login *LoginStart) (*Profile, error) {
+	verifyToken := make([]byte, verifyTokenLength)
+	if _, err := rand.Read(verifyToken); err != nil {
+		return nil, errors.Wrap(err, "failed to generate verify token")
+	}
+
+	fields := []pk.FieldEncoder{
+		pk.String(""), // server ID, always empty since 1.7
+		pk.ByteArray(a.publicKey),
+		pk.ByteArray(verifyToken),
+	}
+	if c.ProtocolVersion >= ProtocolVersion1_20_5 {
+		fields = append(fields, pk.Boolean(true)) // should authenticate
+	}
+	if err := c.WritePacket(pk.Marshal(packetIDEncryptionRequest, fields...)); err != nil {
+		return nil, errors.Wrap(err, "failed to send encryption request")
+	}
+
+	var p pk.Packet
+	if err := c.ReadPacket(&p); err != nil {
+		return nil, errors.Wrap(err, "failed to read encryption response")
+	}
+	if p.ID != packetIDEncryptionResponse {
+		return nil, fmt.Errorf("packet ID 0x%X is not encryption response", p.ID)
+	}
+
+	resp, err := parseEncryptionResponse(&p, c.ProtocolVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse encryption response")
+	}
+	if err := resp.verify(a.key, verifyToken, login); err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := rsa.DecryptPKCS1v15(nil, a.key, resp.SharedSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt shared secret")
+	}
+	if len(sharedSecret) != sharedSecretLength {
+		return nil, fmt.Errorf("shared secret is %d bytes, expected %d", len(sharedSecret), sharedSecretLength)
+	}
+
+	block, err := aes.NewCipher(sharedSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	c.SetCipher(CFB8.NewCFB8Encrypt(block, sharedSecret), CFB8.NewCFB8Decrypt(block, sharedSecret))
+
+	return a.hasJoined(ctx, login.Name, authDigest("", sharedSecret, a.publicKey))
+}
+
+// encryptionResponse is the encryption response packet sent by clients.
+type encryptionResponse struct {
+	// SharedSecret is the shared secret, encrypted with the proxy's
+	// public key.
+	SharedSecret []byte
+
+	// VerifyToken is the verify token, encrypted with the proxy's
+	// public key. It's empty if Signed is true.
+	VerifyToken []byte
+
+	// Signed is true if the client signed the verify token with its
+	// chat signing key, instead of encrypting it. Only 1.19 to 1.19.2
+	// clients do this.
+	Signed bool
+
+	// Salt is the salt the verify token was signed with.
+	Salt int64
+
+	// Signature is the signature of the verify token and salt.
+	Signature []byte
+}
+
+// parseEncryptionResponse parses an encryption response packet sent by
+// a client using the provided protocol version.
+func parseEncryptionResponse(p *pk.Packet, protocolVersion int32) (*encryptionResponse, error) {
+	r := bytes.NewReader(p.Data)
+
+	resp := &encryptionResponse{}
+	if _, err := (*pk.ByteArray)(&resp.SharedSecret).ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to read shared secret: %w", err)
+	}
+
+	// 1.19 to 1.19.2 clients may sign the verify token instead.
+	if protocolVersion >= ProtocolVersion1_19 && protocolVersion < ProtocolVersion1_19_3 {
+		var hasVerifyToken pk.Boolean
+		if _, err := hasVerifyToken.ReadFrom(r); err != nil {
+			return nil, err
+		}
+
+		if !hasVerifyToken {
+			resp.Signed = true
+			for _, field := range []pk.FieldDecoder{(*pk.Long)(&resp.Salt), (*pk.ByteArray)(&resp.Signature)} {
+				if _, err := field.ReadFrom(r); err != nil {
+					return nil, fmt.Errorf("failed to read signature: %w", err)
+				}
+			}
+			return resp, nil
+		}
+	}
+
+	if _, err := (*pk.ByteArray)(&resp.VerifyToken).ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to read verify token: %w", err)
+	}
+
+	return resp, nil
+}
+
+// verify checks that the response answers the encryption request with
+// the provided verify token. Signed tokens are checked against the chat
+// signing key the client sent in the provided login start packet.
+func (r *encryptionResponse) verify(key *rsa.PrivateKey, verifyToken []byte, login *LoginStart) error {
+	if !r.Signed {
+		token, err := rsa.DecryptPKCS1v15(nil, key, r.VerifyToken)
+		if err != nil {
+			return errors.Wrap(err, "failed to decrypt verify token")
+		}
+		if !bytes.Equal(token, verifyToken) {
+			return fmt.Errorf("verify token does not match")
+		}
+
+		return nil
+	}
+
+	if login.Signature == nil {
+		return fmt.Errorf("client signed the verify token without sending a chat signing key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(login.Signature.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse chat signing key")
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("chat signing key is a %T, not an RSA key", pub)
+	}
+
+	// The signed data is the verify token followed by the salt.
+	//nolint:gosec // Why: The salt is signed as its two's complement.
+	signed := binary.BigEndian.AppendUint64(append([]byte{}, verifyToken...), uint64(r.Salt))
+	sum := sha256.Sum256(signed)
+	return errors.Wrap(rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, sum[:], r.Signature), "invalid verify token signature")
+}
+
+// hasJoined asks the session server if the player with the provided
+// name has joined the server identified by serverID, returning their
+// profile if they have.
+func (a *Authenticator) hasJoined(ctx context.Context, name, serverID string) (*Profile, error) {
+	query := url.Values{"username": {name}, "serverId": {serverID}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.sessionServer+"?"+query.Encode(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session server request")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to contact session server")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, ErrNotAuthenticated
+	default:
+		return nil, fmt.Errorf("session server returned %s", resp.Status)
+	}
+
+	var profile Profile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, errors.Wrap(err, "failed to decode profile")
+	}
+
+	return &profile, nil
+}
+
+// authDigest returns the server ID clients and the proxy send to the
+// session server. It's the SHA-1 digest of the provided values, written
+// as a signed hexadecimal number, as Java's BigInteger does.
+func authDigest(serverID string, sharedSecret, publicKey []byte) string {
+	h := sha1.New() //nolint:gosec // Why: The digest is defined as SHA-1.
+	h.Write([]byte(serverID))
+	h.Write(sharedSecret)
+	h.Write(publicKey)
+	sum := h.Sum(nil)
+
+	n := new(big.Int).SetBytes(sum)
+	if sum[0]&0x80 != 0 {
+		// The digest is a two's complement number.
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(sum)*8)))
+	}
+
+	return n.Text(16)
+}
@@ -0,0 +1,313 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mcnet "github.com/Tnze/go-mc/net"
+	"github.com/Tnze/go-mc/net/CFB8"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+)
+
+func TestAuthDigest(t *testing.T) {
+	// Known digests of player names, as used by the vanilla server.
+	tests := map[string]string{
+		"Notch": "4ed1f46bbe04bc756bcb17c0c7ce3e4632f06a48",
+		"jeb_":  "-7c9d5b0044c130109a5d7b5fb5c317c02b4e28c1",
+		"simon": "88e16a1019277b15d58faf0541e11910eb756f6",
+	}
+
+	for name, want := range tests {
+		if got := authDigest(name, nil, nil); got != want {
+			t.Errorf("authDigest(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// testClient is the client side of a login, used to authenticate
+// against a Client.
+type testClient struct {
+	conn *mcnet.Conn
+
+	// protocolVersion is the protocol version the client uses.
+	protocolVersion int32
+
+	// signingKey, if set, is used to sign the verify token instead of
+	// encrypting it.
+	signingKey *rsa.PrivateKey
+}
+
+// respond reads the encryption request and answers it with the provided
+// shared secret, enabling encryption. The server ID digest is returned.
+func (tc *testClient) respond(t *testing.T, sharedSecret []byte) string {
+	var p pk.Packet
+	if err := tc.conn.ReadPacket(&p); err != nil {
+		t.Errorf("failed to read encryption request: %v", err)
+		return ""
+	}
+
+	var serverID pk.String
+	var publicKey, verifyToken pk.ByteArray
+	var shouldAuthenticate pk.Boolean
+	fields := []pk.FieldDecoder{&serverID, &publicKey, &verifyToken}
+	if tc.protocolVersion >= ProtocolVersion1_20_5 {
+		fields = append(fields, &shouldAuthenticate)
+	}
+	if err := p.Scan(fields...); err != nil {
+		t.Errorf("failed to scan encryption request: %v", err)
+		return ""
+	}
+	if tc.protocolVersion >= ProtocolVersion1_20_5 && !shouldAuthenticate {
+		t.Error("encryption request did not ask the client to authenticate")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		t.Errorf("failed to parse public key: %v", err)
+		return ""
+	}
+	rsaPub := pub.(*rsa.PublicKey)
+
+	encryptedSecret, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPub, sharedSecret)
+	if err != nil {
+		t.Errorf("failed to encrypt shared secret: %v", err)
+		return ""
+	}
+
+	resp := []pk.FieldEncoder{pk.ByteArray(encryptedSecret)}
+	hasVerifyTokenField := tc.protocolVersion >= ProtocolVersion1_19 && tc.protocolVersion < ProtocolVersion1_19_3
+	if tc.signingKey != nil {
+		salt := int64(-1234)
+		signed := binary.BigEndian.AppendUint64(append([]byte{}, verifyToken...), uint64(salt))
+		sum := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, tc.signingKey, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Errorf("failed to sign verify token: %v", err)
+			return ""
+		}
+		resp = append(resp, pk.Boolean(false), pk.Long(salt), pk.ByteArray(signature))
+	} else {
+		encryptedToken, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPub, verifyToken)
+		if err != nil {
+			t.Errorf("failed to encrypt verify token: %v", err)
+			return ""
+		}
+		if hasVerifyTokenField {
+			resp = append(resp, pk.Boolean(true))
+		}
+		resp = append(resp, pk.ByteArray(encryptedToken))
+	}
+
+	if err := tc.conn.WritePacket(pk.Marshal(packetIDEncryptionResponse, resp...)); err != nil {
+		t.Errorf("failed to write encryption response: %v", err)
+		return ""
+	}
+
+	block, err := aes.NewCipher(sharedSecret)
+	if err != nil {
+		t.Errorf("failed to create cipher: %v", err)
+		return ""
+	}
+	tc.conn.SetCipher(CFB8.NewCFB8Encrypt(block, sharedSecret), CFB8.NewCFB8Decrypt(block, sharedSecret))
+
+	return authDigest(string(serverID), sharedSecret, publicKey)
+}
+
+// newSessionServer returns a session server that knows of the provided
+// profile joining with the server ID sent on serverIDs.
+func newSessionServer(t *testing.T, profile *Profile, serverIDs <-chan string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := <-serverIDs
+		if r.URL.Query().Get("username") != profile.Name || r.URL.Query().Get("serverId") != want {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		json.NewEncoder(w).Encode(profile)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestAuthenticate(t *testing.T) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingPub, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		signed          bool
+	}{
+		{"1.18.2", 758, false},
+		{"1.19 with verify token", ProtocolVersion1_19, false},
+		{"1.19.2 with signed verify token", ProtocolVersion1_19_1, true},
+		{"1.20.2", ProtocolVersion1_20_2, false},
+		{"1.20.5", ProtocolVersion1_20_5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &Profile{
+				ID:         uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5"),
+				Name:       "Notch",
+				Properties: []ProfileProperty{{Name: "textures", Value: "e30=", Signature: "c2ln"}},
+			}
+			serverIDs := make(chan string, 1)
+			srv := newSessionServer(t, profile, serverIDs)
+
+			a, err := NewAuthenticator()
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.sessionServer = srv.URL
+
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			tc := &testClient{conn: mcnet.WrapConn(clientConn), protocolVersion: tt.protocolVersion}
+			login := &LoginStart{Name: profile.Name}
+			if tt.signed {
+				tc.signingKey = signingKey
+				login.Signature = &LoginSignature{ExpiresAt: time.Now().Add(time.Hour), PublicKey: signingPub}
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				serverIDs <- tc.respond(t, make([]byte, sharedSecretLength))
+
+				// Anything sent afterwards must be encrypted.
+				if err := tc.conn.WritePacket(pk.Marshal(0x7F, pk.String("encrypted"))); err != nil {
+					t.Errorf("failed to write packet: %v", err)
+				}
+			}()
+
+			c := &Client{Conn: mcnet.WrapConn(serverConn), ProtocolVersion: tt.protocolVersion}
+			got, err := c.Authenticate(context.Background(), a, login)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got.ID != profile.ID || got.Name != profile.Name || len(got.Properties) != 1 || got.Properties[0] != profile.Properties[0] {
+				t.Errorf("Authenticate() = %+v, want %+v", got, profile)
+			}
+
+			var p pk.Packet
+			var s pk.String
+			if err := c.ReadPacket(&p); err != nil {
+				t.Fatalf("failed to read packet: %v", err)
+			}
+			if err := p.Scan(&s); err != nil || p.ID != 0x7F || s != "encrypted" {
+				t.Errorf("read packet 0x%X %q, err = %v, want 0x7F %q", p.ID, s, err, "encrypted")
+			}
+			<-done
+		})
+	}
+}
+
+func TestAuthenticateNotAuthenticated(t *testing.T) {
+	serverIDs := make(chan string, 1)
+	srv := newSessionServer(t, &Profile{Name: "Notch"}, serverIDs)
+
+	a, err := NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.sessionServer = srv.URL
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	tc := &testClient{conn: mcnet.WrapConn(clientConn), protocolVersion: ProtocolVersion1_20_5}
+	go func() {
+		// The client didn't tell the session server it joined, so the
+		// session server doesn't know the server ID.
+		tc.respond(t, make([]byte, sharedSecretLength))
+		serverIDs <- "unknown"
+	}()
+
+	c := &Client{Conn: mcnet.WrapConn(serverConn), ProtocolVersion: ProtocolVersion1_20_5}
+	if _, err := c.Authenticate(context.Background(), a, &LoginStart{Name: "Notch"}); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, ErrNotAuthenticated)
+	}
+}
+
+func TestEncryptionResponseVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyToken := []byte{1, 2, 3, 4}
+
+	wrongToken, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, []byte{4, 3, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		resp  *encryptionResponse
+		login *LoginStart
+	}{
+		{"wrong verify token", &encryptionResponse{VerifyToken: wrongToken}, &LoginStart{}},
+		{"garbage verify token", &encryptionResponse{VerifyToken: []byte("garbage")}, &LoginStart{}},
+		{"signed without a key", &encryptionResponse{Signed: true, Signature: []byte("sig")}, &LoginStart{}},
+		{
+			"bad signature",
+			&encryptionResponse{Signed: true, Signature: []byte("sig")},
+			&LoginStart{Signature: &LoginSignature{PublicKey: publicKey}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.resp.verify(key, verifyToken, tt.login); err == nil {
+				t.Error("verify() error = nil, want an error")
+			}
+		})
+	}
+}
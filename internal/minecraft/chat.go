@@ -0,0 +1,150 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Chat is a chat component, used for the server list description and
+// other text shown to players.
+//
+// See: https://minecraft.wiki/w/Text_component_format
+type Chat struct {
+	Text          string `json:"text"`
+	Translate     string `json:"translate,omitempty"`
+	With          []Chat `json:"with,omitempty"`
+	Color         string `json:"color,omitempty"`
+	Font          string `json:"font,omitempty"`
+	Bold          *bool  `json:"bold,omitempty"`
+	Italic        *bool  `json:"italic,omitempty"`
+	Underlined    *bool  `json:"underlined,omitempty"`
+	Strikethrough *bool  `json:"strikethrough,omitempty"`
+	Obfuscated    *bool  `json:"obfuscated,omitempty"`
+	Extra         []Chat `json:"extra,omitempty"`
+}
+
+// chatFields is Chat without its UnmarshalJSON method.
+type chatFields Chat
+
+// UnmarshalJSON implements json.Unmarshaler. Chat components may be a
+// string, an array of components or an object.
+func (c *Chat) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.HasPrefix(b, []byte(`"`)):
+		*c = Chat{}
+		return json.Unmarshal(b, &c.Text)
+	case bytes.HasPrefix(b, []byte("[")):
+		// The first component is the parent of the rest.
+		var parts []Chat
+		if err := json.Unmarshal(b, &parts); err != nil {
+			return err
+		}
+
+		*c = Chat{}
+		if len(parts) > 0 {
+			*c = parts[0]
+			c.Extra = append(c.Extra, parts[1:]...)
+		}
+		return nil
+	default:
+		*c = Chat{}
+		return json.Unmarshal(b, (*chatFields)(c))
+	}
+}
+
+// ParseChat parses a chat component from the provided string. Strings
+// that are a JSON object or array are parsed as a chat component, all
+// other strings are used as plain text, in which legacy § formatting
+// codes are supported by clients.
+func ParseChat(s string) (*Chat, error) {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return &Chat{Text: s}, nil
+	}
+
+	var c Chat
+	if err := json.Unmarshal([]byte(trimmed), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// legacyColors maps color names to their legacy formatting codes.
+var legacyColors = map[string]string{
+	"black":        "0",
+	"dark_blue":    "1",
+	"dark_green":   "2",
+	"dark_aqua":    "3",
+	"dark_red":     "4",
+	"dark_purple":  "5",
+	"gold":         "6",
+	"gray":         "7",
+	"dark_gray":    "8",
+	"blue":         "9",
+	"green":        "a",
+	"aqua":         "b",
+	"red":          "c",
+	"light_purple": "d",
+	"yellow":       "e",
+	"white":        "f",
+}
+
+// legacyCodes matches legacy § formatting codes.
+var legacyCodes = regexp.MustCompile("§.?")
+
+// Legacy returns the text of the component, and its children, with
+// formatting converted to legacy § codes. Translated components are
+// replaced by their arguments, since there is no way to translate them
+// here.
+func (c *Chat) Legacy() string {
+	var sb strings.Builder
+	c.writeLegacy(&sb)
+	return sb.String()
+}
+
+// writeLegacy writes the legacy representation of c to sb.
+func (c *Chat) writeLegacy(sb *strings.Builder) {
+	if code, ok := legacyColors[c.Color]; ok {
+		sb.WriteString("§" + code)
+	}
+	for _, f := range []struct {
+		enabled *bool
+		code    string
+	}{
+		{c.Obfuscated, "k"},
+		{c.Bold, "l"},
+		{c.Strikethrough, "m"},
+		{c.Underlined, "n"},
+		{c.Italic, "o"},
+	} {
+		if f.enabled != nil && *f.enabled {
+			sb.WriteString("§" + f.code)
+		}
+	}
+
+	sb.WriteString(c.Text)
+	for i := range c.With {
+		c.With[i].writeLegacy(sb)
+	}
+	for i := range c.Extra {
+		c.Extra[i].writeLegacy(sb)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Tnze/go-mc/nbt"
+)
+
+// boolPtr returns a pointer to the provided bool.
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestChatUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Chat
+	}{
+		{
+			name:  "string",
+			input: `"Hello"`,
+			want:  Chat{Text: "Hello"},
+		},
+		{
+			name:  "object",
+			input: `{"text": "Hello", "color": "green", "bold": true, "extra": ["!"]}`,
+			want:  Chat{Text: "Hello", Color: "green", Bold: boolPtr(true), Extra: []Chat{{Text: "!"}}},
+		},
+		{
+			name:  "array",
+			input: ` [{"text": "Hello", "italic": false}, " ", {"text": "world"}]`,
+			want:  Chat{Text: "Hello", Italic: boolPtr(false), Extra: []Chat{{Text: " "}, {Text: "world"}}},
+		},
+		{
+			name:  "array keeps the parent's children first",
+			input: `[{"text": "a", "extra": ["b"]}, "c"]`,
+			want:  Chat{Text: "a", Extra: []Chat{{Text: "b"}, {Text: "c"}}},
+		},
+		{
+			name:  "empty array",
+			input: `[]`,
+			want:  Chat{},
+		},
+		{
+			name:  "translate",
+			input: `{"translate": "multiplayer.disconnect.kicked", "with": [{"text": "Notch"}]}`,
+			want:  Chat{Translate: "multiplayer.disconnect.kicked", With: []Chat{{Text: "Notch"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Decoding into an existing component must replace it.
+			got := Chat{Text: "stale", Color: "red"}
+			if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *Chat
+		wantErr bool
+	}{
+		{name: "plain text", input: "§aHello", want: &Chat{Text: "§aHello"}},
+		{name: "plain text keeps whitespace", input: " Hello ", want: &Chat{Text: " Hello "}},
+		{name: "object", input: ` {"text": "Hello"}`, want: &Chat{Text: "Hello"}},
+		{name: "array", input: `["Hello", "!"]`, want: &Chat{Text: "Hello", Extra: []Chat{{Text: "!"}}}},
+		{name: "invalid JSON", input: `{"text": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChat(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChat() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseChat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		chat Chat
+		want string
+	}{
+		{
+			name: "plain",
+			chat: Chat{Text: "Hello"},
+			want: "Hello",
+		},
+		{
+			name: "color and formatting",
+			chat: Chat{Text: "Hello", Color: "gold", Bold: boolPtr(true), Italic: boolPtr(false), Obfuscated: boolPtr(true)},
+			want: "§6§k§lHello",
+		},
+		{
+			name: "unknown color",
+			chat: Chat{Text: "Hello", Color: "#ff0000"},
+			want: "Hello",
+		},
+		{
+			name: "children",
+			chat: Chat{Text: "Hello", Color: "green", Extra: []Chat{{Text: " "}, {Text: "world", Underlined: boolPtr(true)}}},
+			want: "§aHello §nworld",
+		},
+		{
+			name: "translate uses arguments",
+			chat: Chat{Translate: "chat.type.text", With: []Chat{{Text: "Notch"}, {Text: "hi"}}},
+			want: "Notchhi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chat.Legacy(); got != tt.want {
+				t.Errorf("Legacy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNBTChat(t *testing.T) {
+	tests := []struct {
+		name string
+		chat Chat
+		want map[string]any
+	}{
+		{
+			name: "text",
+			chat: Chat{Text: "Hello"},
+			want: map[string]any{"text": "Hello"},
+		},
+		{
+			name: "all fields",
+			chat: Chat{
+				Text:          "Hello",
+				Translate:     "chat.type.text",
+				Color:         "green",
+				Font:          "minecraft:uniform",
+				Bold:          boolPtr(true),
+				Italic:        boolPtr(false),
+				Underlined:    boolPtr(true),
+				Strikethrough: boolPtr(false),
+				Obfuscated:    boolPtr(true),
+				With:          []Chat{{Text: "Notch"}},
+				Extra:         []Chat{{Text: "!", Color: "red"}, {Text: "?"}},
+			},
+			want: map[string]any{
+				"text":          "Hello",
+				"translate":     "chat.type.text",
+				"color":         "green",
+				"font":          "minecraft:uniform",
+				"bold":          int8(1),
+				"italic":        int8(0),
+				"underlined":    int8(1),
+				"strikethrough": int8(0),
+				"obfuscated":    int8(1),
+				"with":          []any{map[string]any{"text": "Notch"}},
+				"extra":         []any{map[string]any{"text": "!", "color": "red"}, map[string]any{"text": "?"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := (*nbtChat)(&tt.chat).WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if int(n) != buf.Len() {
+				t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+			}
+
+			// Decode it with an independent implementation.
+			d := nbt.NewDecoder(&buf)
+			d.NetworkFormat(true)
+
+			var got map[string]any
+			if _, err := d.Decode(&got); err != nil {
+				t.Fatalf("failed to decode NBT: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WriteTo() decoded to %#v, want %#v", got, tt.want)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("WriteTo() wrote %d trailing bytes", buf.Len())
+			}
+		})
+	}
+}
@@ -18,12 +18,15 @@
 package minecraft
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	mcnet "github.com/Tnze/go-mc/net"
 	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -47,6 +50,10 @@ const (
 	// ClientStatePlayerLogin is the state of the client when trying to login to
 	// the server
 	ClientStatePlayerLogin
+
+	// ClientStateTransfer is the state of the client when trying to login
+	// to the server after being transferred to it by another server.
+	ClientStateTransfer
 )
 
 // Handshake is the first packet sent to a Minecraft server.
@@ -74,6 +81,10 @@ type Handshake struct {
 
 	// NextState is the next state the client is trying to transition to.
 	NextState int32
+
+	// RawServerAddress is the server address as sent by the client,
+	// including any data after NULL characters.
+	RawServerAddress string
 }
 
 // Handshake reads the handshake packet and returns the next state
@@ -97,6 +108,7 @@ func (c *Client) Handshake() (*Handshake, error) {
 
 	// if there's null characters in the server address, use the data
 	// before the first null character.
+	h.RawServerAddress = h.ServerAddress
 	nullData := strings.Split(h.ServerAddress, "\x00")
 	if len(nullData) > 0 {
 		h.ServerAddress = nullData[0]
@@ -108,19 +120,75 @@ func (c *Client) Handshake() (*Handshake, error) {
 	return h, nil
 }
 
+// Rewrite returns a copy of the original handshake packet with the
+// server address and next state replaced by the provided values.
+func (h *Handshake) Rewrite(serverAddress string, state ClientState) *pk.Packet {
+	p := pk.Marshal(
+		h.Packet.ID,
+		pk.VarInt(h.ProtocolVersion),
+		pk.String(serverAddress),
+		pk.UnsignedShort(h.ServerPort),
+		pk.VarInt(state),
+	)
+	return &p
+}
+
+// BungeeCordAddress returns the provided server address with the
+// client's IP, and the player's UUID and properties, appended as
+// expected by servers configured for BungeeCord's legacy IP forwarding.
+//
+// See: https://www.spigotmc.org/wiki/bungeecord-ip-forwarding/
+func BungeeCordAddress(serverAddress, clientIP string, profile *Profile) (string, error) {
+	// BungeeCord sends UUIDs without dashes.
+	fields := []string{serverAddress, clientIP, strings.ReplaceAll(profile.ID.String(), "-", "")}
+	if len(profile.Properties) > 0 {
+		b, err := json.Marshal(profile.Properties)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to encode properties")
+		}
+		fields = append(fields, string(b))
+	}
+
+	return strings.Join(fields, "\x00"), nil
+}
+
 // LoginStart is the packet sent by the client when they're trying to login
 // to the server.
 //
 // See https://wiki.vg/Protocol#Login_Start.
 type LoginStart struct {
 	Name string `json:"name"`
+
+	// UUID is the UUID of the player. Clients older than 1.19.1 don't
+	// send it, and it's optional until 1.20.2, in which case it's
+	// uuid.Nil.
+	UUID uuid.UUID `json:"uuid"`
+
+	// Signature is the player's chat signing key. Only 1.19 to 1.19.2
+	// clients send it, and only optionally.
+	Signature *LoginSignature `json:"signature,omitempty"`
+}
+
+// LoginSignature is the chat signing key sent by 1.19 to 1.19.2 clients
+// in login start.
+type LoginSignature struct {
+	// ExpiresAt is when the key expires.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// PublicKey is the DER encoded public key.
+	PublicKey []byte `json:"publicKey"`
+
+	// Signature is the signature of the key, made by Mojang.
+	Signature []byte `json:"signature"`
 }
 
 // ReadLoginStart reads the login start packet from the client. It returns
 // the parsed packet, the original packet, and an error if one occurred.
+// The packet is decoded according to the client's protocol version.
 //
-// This should not be trusted as the client can send any string they want
-// and hasn't been authenticated until later in the login process.
+// This should not be trusted as the client can send any name and UUID
+// they want and hasn't been authenticated until later in the login
+// process.
 func (c *Client) ReadLoginStart() (*LoginStart, *pk.Packet, error) {
 	var p pk.Packet
 	if err := c.ReadPacket(&p); err != nil {
@@ -130,26 +198,75 @@ func (c *Client) ReadLoginStart() (*LoginStart, *pk.Packet, error) {
 		return nil, nil, fmt.Errorf("packet ID 0x%X is not login start", p.ID)
 	}
 
-	var name pk.String
-	if err := p.Scan(&name); err != nil {
-		return nil, nil, err
+	login, err := parseLoginStart(&p, c.ProtocolVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse login start: %w", err)
 	}
 
-	return &LoginStart{Name: string(name)}, &p, nil
+	return login, &p, nil
 }
 
-// SendDisconnect sends a disconnect packet to the client with the provided reason
-func (c *Client) SendDisconnect(reason string) error {
-	disconnect := map[string]interface{}{
-		"translate": "chat.type.text",
-		"with": []interface{}{
-			map[string]interface{}{
-				"text": reason,
-			},
-		},
+// parseLoginStart parses a login start packet sent by a client using
+// the provided protocol version.
+func parseLoginStart(p *pk.Packet, protocolVersion int32) (*LoginStart, error) {
+	r := bytes.NewReader(p.Data)
+
+	var name pk.String
+	if _, err := name.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	login := &LoginStart{Name: string(name)}
+
+	// 1.19 to 1.19.2 clients may send their chat signing key.
+	if protocolVersion >= ProtocolVersion1_19 && protocolVersion < ProtocolVersion1_19_3 {
+		var hasSignature pk.Boolean
+		if _, err := hasSignature.ReadFrom(r); err != nil {
+			return nil, err
+		}
+
+		if hasSignature {
+			var expiresAt pk.Long
+			var publicKey, signature pk.ByteArray
+			for _, field := range []pk.FieldDecoder{&expiresAt, &publicKey, &signature} {
+				if _, err := field.ReadFrom(r); err != nil {
+					return nil, fmt.Errorf("failed to read signature: %w", err)
+				}
+			}
+
+			login.Signature = &LoginSignature{
+				ExpiresAt: time.UnixMilli(int64(expiresAt)),
+				PublicKey: publicKey,
+				Signature: signature,
+			}
+		}
 	}
 
-	b, err := json.Marshal(disconnect)
+	switch {
+	case protocolVersion >= ProtocolVersion1_20_2:
+		if _, err := (*pk.UUID)(&login.UUID).ReadFrom(r); err != nil {
+			return nil, fmt.Errorf("failed to read uuid: %w", err)
+		}
+	case protocolVersion >= ProtocolVersion1_19_1:
+		var hasUUID pk.Boolean
+		if _, err := hasUUID.ReadFrom(r); err != nil {
+			return nil, err
+		}
+
+		if hasUUID {
+			if _, err := (*pk.UUID)(&login.UUID).ReadFrom(r); err != nil {
+				return nil, fmt.Errorf("failed to read uuid: %w", err)
+			}
+		}
+	}
+
+	return login, nil
+}
+
+// SendDisconnect sends a disconnect packet to the client with the provided reason.
+// This must only be used in the login state.
+func (c *Client) SendDisconnect(reason *Chat) error {
+	// Login disconnects are always sent as JSON, even after 1.20.3.
+	b, err := json.Marshal(reason)
 	if err != nil {
 		return err
 	}
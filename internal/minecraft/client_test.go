@@ -0,0 +1,184 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+)
+
+func TestBungeeCordAddress(t *testing.T) {
+	id := uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5")
+
+	tests := []struct {
+		name    string
+		profile *Profile
+		want    string
+	}{
+		{
+			name:    "without properties",
+			profile: &Profile{ID: id, Name: "Notch"},
+			want:    "mc.example.com\x00192.0.2.1\x00069a79f444e94726a5befca90e38aaf5",
+		},
+		{
+			name: "with properties",
+			profile: &Profile{ID: id, Name: "Notch", Properties: []ProfileProperty{
+				{Name: "textures", Value: "e30=", Signature: "c2ln"},
+				{Name: "unsigned", Value: "e30="},
+			}},
+			want: "mc.example.com\x00192.0.2.1\x00069a79f444e94726a5befca90e38aaf5\x00" +
+				`[{"name":"textures","value":"e30=","signature":"c2ln"},{"name":"unsigned","value":"e30="}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BungeeCordAddress("mc.example.com", "192.0.2.1", tt.profile)
+			if err != nil {
+				t.Fatalf("BungeeCordAddress() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("BungeeCordAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLoginStart(t *testing.T) {
+	id := uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5")
+	expiresAt := time.UnixMilli(1700000000000)
+	signature := &LoginSignature{ExpiresAt: expiresAt, PublicKey: []byte("key"), Signature: []byte("sig")}
+	signatureFields := []pk.FieldEncoder{
+		pk.Boolean(true), pk.Long(expiresAt.UnixMilli()), pk.ByteArray("key"), pk.ByteArray("sig"),
+	}
+
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		fields          []pk.FieldEncoder
+		want            *LoginStart
+		wantErr         string
+	}{
+		{
+			name:            "1.18.2",
+			protocolVersion: 758,
+			fields:          []pk.FieldEncoder{pk.String("Notch")},
+			want:            &LoginStart{Name: "Notch"},
+		},
+		{
+			name:            "1.19 without signature",
+			protocolVersion: ProtocolVersion1_19,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.Boolean(false)},
+			want:            &LoginStart{Name: "Notch"},
+		},
+		{
+			name:            "1.19 with signature",
+			protocolVersion: ProtocolVersion1_19,
+			fields:          append([]pk.FieldEncoder{pk.String("Notch")}, signatureFields...),
+			want:            &LoginStart{Name: "Notch", Signature: signature},
+		},
+		{
+			name:            "1.19 truncated signature",
+			protocolVersion: ProtocolVersion1_19,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.Boolean(true), pk.Long(0)},
+			wantErr:         "failed to read signature",
+		},
+		{
+			name:            "1.19.1 with signature and UUID",
+			protocolVersion: ProtocolVersion1_19_1,
+			fields: append(append([]pk.FieldEncoder{pk.String("Notch")}, signatureFields...),
+				pk.Boolean(true), pk.UUID(id)),
+			want: &LoginStart{Name: "Notch", UUID: id, Signature: signature},
+		},
+		{
+			name:            "1.19.1 without signature or UUID",
+			protocolVersion: ProtocolVersion1_19_1,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.Boolean(false), pk.Boolean(false)},
+			want:            &LoginStart{Name: "Notch"},
+		},
+		{
+			name:            "1.19.3 with UUID",
+			protocolVersion: ProtocolVersion1_19_3,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.Boolean(true), pk.UUID(id)},
+			want:            &LoginStart{Name: "Notch", UUID: id},
+		},
+		{
+			name:            "1.19.3 without UUID",
+			protocolVersion: ProtocolVersion1_19_3,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.Boolean(false)},
+			want:            &LoginStart{Name: "Notch"},
+		},
+		{
+			name:            "1.20.2",
+			protocolVersion: ProtocolVersion1_20_2,
+			fields:          []pk.FieldEncoder{pk.String("Notch"), pk.UUID(id)},
+			want:            &LoginStart{Name: "Notch", UUID: id},
+		},
+		{
+			name:            "1.20.2 missing UUID",
+			protocolVersion: ProtocolVersion1_20_2,
+			fields:          []pk.FieldEncoder{pk.String("Notch")},
+			wantErr:         "failed to read uuid",
+		},
+		{
+			name:            "empty",
+			protocolVersion: ProtocolVersion1_20_2,
+			wantErr:         "EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pk.Marshal(0x00, tt.fields...)
+			got, err := parseLoginStart(&p, tt.protocolVersion)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseLoginStart() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLoginStart() error = %v", err)
+			}
+
+			if got.Name != tt.want.Name || got.UUID != tt.want.UUID {
+				t.Errorf("parseLoginStart() = %q %s, want %q %s", got.Name, got.UUID, tt.want.Name, tt.want.UUID)
+			}
+			assertLoginSignature(t, got.Signature, tt.want.Signature)
+		})
+	}
+}
+
+// assertLoginSignature fails the test if got doesn't equal want.
+func assertLoginSignature(t *testing.T, got, want *LoginSignature) {
+	t.Helper()
+
+	if got == nil || want == nil {
+		if got != want {
+			t.Errorf("Signature = %+v, want %+v", got, want)
+		}
+		return
+	}
+
+	if !got.ExpiresAt.Equal(want.ExpiresAt) || string(got.PublicKey) != string(want.PublicKey) ||
+		string(got.Signature) != string(want.Signature) {
+		t.Errorf("Signature = %+v, want %+v", got, want)
+	}
+}
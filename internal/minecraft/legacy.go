@@ -0,0 +1,220 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Contains the packet IDs used by the legacy (pre-1.7) server list
+// ping. These are sent without VarInt framing.
+const (
+	// legacyPacketIDPing is the first byte sent by legacy clients
+	// pinging the server.
+	legacyPacketIDPing byte = 0xFE
+
+	// legacyPacketIDPluginMessage is the plugin message 1.6 clients
+	// send after the ping, containing the hostname and port.
+	legacyPacketIDPluginMessage byte = 0xFA
+
+	// legacyPacketIDKick is the packet the ping is answered with.
+	legacyPacketIDKick byte = 0xFF
+)
+
+// legacyPingWait is how long to wait for the rest of a legacy ping
+// after the first byte. Beta clients only send a single byte, so this
+// is how we tell them apart.
+const legacyPingWait = 250 * time.Millisecond
+
+// LegacyPing is a server list ping sent by a client older than 1.7.
+//
+// See: https://wiki.vg/Server_List_Ping#1.6
+type LegacyPing struct {
+	// Beta is true if the ping was sent by a Beta 1.8 to 1.3 client,
+	// which expects the oldest response format.
+	Beta bool
+
+	// ProtocolVersion is the protocol version of the client. Only 1.6
+	// clients send this, it's 0 otherwise.
+	ProtocolVersion int32
+
+	// ServerAddress is the address of the server the client is
+	// pinging. Only 1.6 clients send this, it's empty otherwise.
+	ServerAddress string
+
+	// ServerPort is the port of the server the client is pinging. Only
+	// 1.6 clients send this, it's 0 otherwise.
+	ServerPort uint16
+}
+
+// ReadLegacyPing checks if the client started the connection with a
+// legacy server list ping. If it didn't, nil is returned and the data
+// read is left for Handshake to read. If it did, the connection's read
+// deadline is changed while reading the rest of the ping.
+//
+// Note: A modern handshake with a length of 254 bytes or more may also
+// start with 0xFE. Like other proxies, we treat these as legacy pings.
+func (c *Client) ReadLegacyPing() (*LegacyPing, error) {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(c.Conn.Reader, first); err != nil {
+		return nil, err
+	}
+	if first[0] != legacyPacketIDPing {
+		c.Conn.Reader = io.MultiReader(bytes.NewReader(first), c.Conn.Reader)
+		return nil, nil
+	}
+
+	// 1.4+ clients immediately follow the ping with 0x01, Beta clients
+	// send nothing else.
+	if err := c.Socket.SetReadDeadline(time.Now().Add(legacyPingWait)); err != nil {
+		return nil, err
+	}
+
+	// No more data, or a timeout, means a Beta client.
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(c.Conn.Reader, b); err != nil || b[0] != 0x01 {
+		return &LegacyPing{Beta: true}, nil
+	}
+
+	// 1.6 clients follow with a plugin message containing the hostname
+	// they're pinging. 1.4 and 1.5 clients don't, which isn't an error.
+	ping := &LegacyPing{}
+	if _, err := io.ReadFull(c.Conn.Reader, b); err != nil || b[0] != legacyPacketIDPluginMessage {
+		return ping, nil
+	}
+	if err := ping.readPingHost(c.Conn.Reader); err != nil {
+		return nil, fmt.Errorf("failed to read legacy ping host: %w", err)
+	}
+
+	return ping, nil
+}
+
+// readPingHost reads the MC|PingHost plugin message sent by 1.6
+// clients, after the packet ID.
+func (p *LegacyPing) readPingHost(r io.Reader) error {
+	channel, err := readLegacyString(r)
+	if err != nil {
+		return err
+	}
+	if channel != "MC|PingHost" {
+		return fmt.Errorf("unexpected channel %q", channel)
+	}
+
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+
+	dr := bytes.NewReader(data)
+	protocol, err := dr.ReadByte()
+	if err != nil {
+		return err
+	}
+	host, err := readLegacyString(dr)
+	if err != nil {
+		return err
+	}
+	var port int32
+	if err := binary.Read(dr, binary.BigEndian, &port); err != nil {
+		return err
+	}
+
+	p.ProtocolVersion = int32(protocol)
+	p.ServerAddress = host
+	p.ServerPort = uint16(port) //nolint:gosec // Why: Ports fit in 16 bits.
+	return nil
+}
+
+// SendLegacyStatus answers a legacy server list ping with the provided
+// status. Legacy clients expect the connection to be closed afterwards.
+func (c *Client) SendLegacyStatus(ping *LegacyPing, status *Status) error {
+	var motd, version string
+	var protocol, online, maxPlayers int
+	if status.Description != nil {
+		motd = status.Description.Legacy()
+	}
+	if status.Version != nil {
+		version = status.Version.Name
+		protocol = status.Version.Protocol
+	}
+	if status.Players != nil {
+		online = status.Players.Online
+		maxPlayers = status.Players.Max
+	}
+
+	var resp string
+	if ping.Beta {
+		// The fields are separated by §, so it can't be used for
+		// formatting.
+		resp = strings.Join([]string{
+			legacyCodes.ReplaceAllString(motd, ""),
+			strconv.Itoa(online),
+			strconv.Itoa(maxPlayers),
+		}, "§")
+	} else {
+		resp = strings.Join([]string{
+			"§1",
+			strconv.Itoa(protocol),
+			version,
+			motd,
+			strconv.Itoa(online),
+			strconv.Itoa(maxPlayers),
+		}, "\x00")
+	}
+
+	_, err := c.Socket.Write(append([]byte{legacyPacketIDKick}, encodeLegacyString(resp)...))
+	return err
+}
+
+// readLegacyString reads a string prefixed with its length in UTF-16
+// code units, encoded as UTF-16BE.
+func readLegacyString(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+
+	units := make([]uint16, length)
+	if err := binary.Read(r, binary.BigEndian, units); err != nil {
+		return "", err
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// encodeLegacyString encodes a string prefixed with its length in
+// UTF-16 code units, encoded as UTF-16BE.
+func encodeLegacyString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(units))) //nolint:gosec // Why: Statuses are short.
+	for _, u := range units {
+		b = binary.BigEndian.AppendUint16(b, u)
+	}
+
+	return b
+}
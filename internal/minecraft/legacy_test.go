@@ -0,0 +1,200 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	mcnet "github.com/Tnze/go-mc/net"
+	pk "github.com/Tnze/go-mc/net/packet"
+)
+
+// newPipeClient returns a Client connected to the returned connection,
+// which acts as the remote client.
+func newPipeClient(t *testing.T) (*Client, net.Conn) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	return &Client{Conn: mcnet.WrapConn(server)}, client
+}
+
+// pingHost returns a 1.6 MC|PingHost plugin message, including its
+// packet ID, with the provided channel.
+func pingHost(channel string, protocol byte, host string, port int32) []byte {
+	data := append([]byte{protocol}, encodeLegacyString(host)...)
+	data = binary.BigEndian.AppendUint32(data, uint32(port)) //nolint:gosec // Why: Test ports are positive.
+
+	b := append([]byte{legacyPacketIDPluginMessage}, encodeLegacyString(channel)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data))) //nolint:gosec // Why: Test data is short.
+	return append(b, data...)
+}
+
+func TestReadLegacyPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    *LegacyPing
+		wantErr string
+	}{
+		{
+			name:  "beta",
+			input: []byte{legacyPacketIDPing},
+			want:  &LegacyPing{Beta: true},
+		},
+		{
+			name:  "1.4",
+			input: []byte{legacyPacketIDPing, 0x01},
+			want:  &LegacyPing{},
+		},
+		{
+			name:  "1.6",
+			input: append([]byte{legacyPacketIDPing, 0x01}, pingHost("MC|PingHost", 74, "mc.example.com", 25565)...),
+			want:  &LegacyPing{ProtocolVersion: 74, ServerAddress: "mc.example.com", ServerPort: 25565},
+		},
+		{
+			name:    "1.6 unknown channel",
+			input:   append([]byte{legacyPacketIDPing, 0x01}, pingHost("MC|Other", 74, "mc.example.com", 25565)...),
+			wantErr: `unexpected channel "MC|Other"`,
+		},
+		{
+			name:    "1.6 truncated",
+			input:   append([]byte{legacyPacketIDPing, 0x01}, pingHost("MC|PingHost", 74, "mc.example.com", 25565)[:20]...),
+			wantErr: "failed to read legacy ping host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, client := newPipeClient(t)
+			go func() {
+				client.Write(tt.input)
+				if tt.wantErr != "" {
+					// Let truncated pings fail, rather than time out.
+					client.Close()
+				}
+			}()
+
+			got, err := c.ReadLegacyPing()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadLegacyPing() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadLegacyPing() error = %v", err)
+			}
+			if got == nil || *got != *tt.want {
+				t.Errorf("ReadLegacyPing() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLegacyPingModernHandshake(t *testing.T) {
+	c, client := newPipeClient(t)
+
+	handshake := pk.Marshal(0x00, pk.VarInt(765), pk.String("mc.example.com"), pk.UnsignedShort(25565), pk.VarInt(1))
+	go mcnet.WrapConn(client).WritePacket(handshake)
+
+	ping, err := c.ReadLegacyPing()
+	if err != nil || ping != nil {
+		t.Fatalf("ReadLegacyPing() = %+v, %v, want nil, nil", ping, err)
+	}
+
+	// The byte read to check for a legacy ping must still be there.
+	h, err := c.Handshake()
+	if err != nil {
+		t.Fatalf("Handshake() error = %v", err)
+	}
+	if h.ProtocolVersion != 765 || h.ServerAddress != "mc.example.com" || h.ServerPort != 25565 || h.NextState != 1 {
+		t.Errorf("Handshake() = %+v", h)
+	}
+}
+
+func TestSendLegacyStatus(t *testing.T) {
+	status := &Status{
+		Version:     &StatusVersion{Name: "1.20.4", Protocol: 765},
+		Players:     &StatusPlayers{Online: 3, Max: 20},
+		Description: &Chat{Text: "Hello", Color: "green", Extra: []Chat{{Text: " world"}}},
+	}
+
+	tests := []struct {
+		name   string
+		ping   *LegacyPing
+		status *Status
+		want   string
+	}{
+		{
+			name:   "beta",
+			ping:   &LegacyPing{Beta: true},
+			status: status,
+			want:   "Hello world§3§20",
+		},
+		{
+			name:   "1.4",
+			ping:   &LegacyPing{},
+			status: status,
+			want:   "§1\x00765\x001.20.4\x00§aHello world\x003\x0020",
+		},
+		{
+			name:   "empty status",
+			ping:   &LegacyPing{},
+			status: &Status{},
+			want:   "§1\x000\x00\x00\x000\x000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, client := newPipeClient(t)
+			go func() {
+				c.SendLegacyStatus(tt.ping, tt.status)
+				c.Close()
+			}()
+
+			b, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) < 3 || b[0] != legacyPacketIDKick {
+				t.Fatalf("SendLegacyStatus() sent %q, want a kick packet", b)
+			}
+
+			length := binary.BigEndian.Uint16(b[1:])
+			units := make([]uint16, (len(b)-3)/2)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(b[3+i*2:])
+			}
+			if int(length) != len(units) {
+				t.Errorf("SendLegacyStatus() length = %d, want %d", length, len(units))
+			}
+			if got := string(utf16.Decode(units)); got != tt.want {
+				t.Errorf("SendLegacyStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
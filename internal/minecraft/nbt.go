@@ -0,0 +1,125 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Contains the NBT tag types used to encode chat components.
+//
+// See: https://minecraft.wiki/w/NBT_format
+const (
+	nbtTagEnd      byte = 0x00
+	nbtTagByte     byte = 0x01
+	nbtTagList     byte = 0x09
+	nbtTagString   byte = 0x08
+	nbtTagCompound byte = 0x0A
+)
+
+// nbtChat is a chat component encoded as network NBT, as sent by the
+// server starting with 1.20.3.
+type nbtChat Chat
+
+// WriteTo implements pk.FieldEncoder.
+func (c *nbtChat) WriteTo(w io.Writer) (int64, error) {
+	// Network NBT has a nameless root tag.
+	b := append([]byte{nbtTagCompound}, (*Chat)(c).appendNBT(nil)...)
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// appendNBT appends the payload of the component, as an NBT compound,
+// to b.
+func (c *Chat) appendNBT(b []byte) []byte {
+	b = appendNBTString(b, "text", c.Text)
+	for _, f := range []struct{ name, value string }{
+		{"translate", c.Translate},
+		{"color", c.Color},
+		{"font", c.Font},
+	} {
+		if f.value != "" {
+			b = appendNBTString(b, f.name, f.value)
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		value *bool
+	}{
+		{"bold", c.Bold},
+		{"italic", c.Italic},
+		{"underlined", c.Underlined},
+		{"strikethrough", c.Strikethrough},
+		{"obfuscated", c.Obfuscated},
+	} {
+		if f.value == nil {
+			continue
+		}
+
+		b = appendNBTName(b, nbtTagByte, f.name)
+		if *f.value {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		value []Chat
+	}{
+		{"with", c.With},
+		{"extra", c.Extra},
+	} {
+		if len(f.value) == 0 {
+			continue
+		}
+
+		b = appendNBTName(b, nbtTagList, f.name)
+		b = append(b, nbtTagCompound)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f.value))) //nolint:gosec // Why: Components are small.
+		for i := range f.value {
+			b = f.value[i].appendNBT(b)
+		}
+	}
+
+	return append(b, nbtTagEnd)
+}
+
+// appendNBTName appends the type and name of a named tag to b.
+func appendNBTName(b []byte, tag byte, name string) []byte {
+	b = append(b, tag)
+	return appendNBTStringPayload(b, name)
+}
+
+// appendNBTString appends a named string tag to b.
+func appendNBTString(b []byte, name, value string) []byte {
+	b = appendNBTName(b, nbtTagString, name)
+	return appendNBTStringPayload(b, value)
+}
+
+// appendNBTStringPayload appends a length prefixed string to b.
+//
+// Note: NBT uses modified UTF-8, which only differs from UTF-8 for NUL
+// and characters outside the BMP, such as emoji. These aren't encoded
+// correctly.
+func appendNBTStringPayload(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s))) //nolint:gosec // Why: Messages are short.
+	return append(b, s...)
+}
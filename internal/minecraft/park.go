@@ -0,0 +1,303 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"encoding/json"
+	"fmt"
+
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Parked is a client that has been logged in by the proxy itself and is
+// being held until the server it wants to join is ready. Clients that
+// support it are spawned in an empty world, in the play state, where the
+// server's progress can be shown with a boss bar, see ShowStatus.
+// Others are held in the configuration state, on the client's joining
+// screen, where nothing but the joining screen can be shown. While
+// parked, the client must be sent keep alives to prevent it from timing
+// out.
+//
+// Parking is only supported by clients that have a configuration state
+// (1.20.2+), see SupportsParking. Parking in the play state is only
+// supported by 1.20.2 to 1.20.4 clients.
+type Parked struct {
+	c *Client
+
+	// packets are the packets for the client's protocol version, in the
+	// state it's parked in.
+	packets parkedPackets
+
+	// play are the play state packets for the client's protocol
+	// version, if it's parked in the play state.
+	play *playPackets
+
+	// keepAliveID is the ID of the last keep alive sent to the client.
+	keepAliveID int64
+
+	// bossBar is true once the boss bar has been added, see ShowStatus.
+	bossBar bool
+}
+
+// SupportsParking returns true if the provided protocol version can be
+// parked.
+func SupportsParking(protocolVersion int32) bool {
+	_, ok := getConfigurationPackets(protocolVersion)
+	return ok
+}
+
+// Park completes the login sequence for the client on behalf of the
+// server, logging it in as the provided profile, and moves it into the
+// configuration state or, if supported, spawns it in an empty world. The
+// client's login start packet must have been read from the client
+// already.
+func (c *Client) Park(profile *Profile) (*Parked, error) {
+	packets, ok := getConfigurationPackets(c.ProtocolVersion)
+	if !ok {
+		return nil, fmt.Errorf("protocol version %d does not support parking", c.ProtocolVersion)
+	}
+
+	fields := []pk.FieldEncoder{pk.UUID(profile.ID), pk.String(profile.Name)}
+	fields = append(fields, propertyFields(profile.Properties)...)
+	if c.ProtocolVersion >= ProtocolVersion1_20_5 && c.ProtocolVersion < ProtocolVersion1_21_2 {
+		fields = append(fields, pk.Boolean(false)) // strict error handling
+	}
+	if err := c.WritePacket(pk.Marshal(packetIDLoginSuccess, fields...)); err != nil {
+		return nil, errors.Wrap(err, "failed to send login success")
+	}
+
+	// Wait for the client to acknowledge the login, at which point it
+	// is in the configuration state.
+	if err := c.waitForPacket(packetIDLoginAcknowledged); err != nil {
+		return nil, errors.Wrap(err, "failed to read login acknowledged")
+	}
+
+	play, ok := getPlayPackets(c.ProtocolVersion)
+	if !ok {
+		return &Parked{c: c, packets: packets.parkedPackets}, nil
+	}
+
+	if err := c.spawn(&packets, &play); err != nil {
+		return nil, errors.Wrap(err, "failed to spawn player")
+	}
+
+	return &Parked{c: c, packets: play.parkedPackets, play: &play}, nil
+}
+
+// waitForPacket reads, and discards, packets from the client until one
+// with the provided ID is read.
+func (c *Client) waitForPacket(id int32) error {
+	for {
+		var p pk.Packet
+		if err := c.ReadPacket(&p); err != nil {
+			return err
+		}
+		if p.ID == id {
+			return nil
+		}
+	}
+}
+
+// parkingPositionY is the height parked players are spawned at, above
+// the parking world's build height. Clients consider the world loaded
+// once the player is outside of it, so no chunks have to be sent.
+const parkingPositionY = 400
+
+// gameModeSpectator is the spectator game mode, which parked players are
+// put in so they don't fall, or interact with anything.
+const gameModeSpectator = 3
+
+// gameEventStartWaitingForChunks is the game event that tells 1.20.3+
+// clients the world is being sent, without which they stay on the
+// loading screen.
+const gameEventStartWaitingForChunks = 13
+
+// spawn moves a client in the configuration state to the play state,
+// spawning it in an empty world.
+func (c *Client) spawn(config *configurationPackets, play *playPackets) error {
+	if err := c.WritePacket(pk.Marshal(config.RegistryData, pk.NBT(parkingRegistries()))); err != nil {
+		return errors.Wrap(err, "failed to send registry data")
+	}
+	if err := c.WritePacket(pk.Marshal(config.FinishConfiguration)); err != nil {
+		return errors.Wrap(err, "failed to send finish configuration")
+	}
+	if err := c.waitForPacket(config.AcknowledgeFinishConfiguration); err != nil {
+		return errors.Wrap(err, "failed to read finish configuration acknowledgement")
+	}
+
+	dimensions := pk.Array([]pk.Identifier{parkingDimension})
+	if err := c.WritePacket(pk.Marshal(play.Login,
+		pk.Int(1),         // entity ID
+		pk.Boolean(false), // hardcore
+		dimensions,
+		pk.VarInt(1),                       // max players
+		pk.VarInt(2),                       // view distance
+		pk.VarInt(2),                       // simulation distance
+		pk.Boolean(false),                  // reduced debug info
+		pk.Boolean(true),                   // enable respawn screen
+		pk.Boolean(false),                  // limited crafting
+		pk.Identifier(parkingDimension),    // dimension type
+		pk.Identifier(parkingDimension),    // dimension name
+		pk.Long(0),                         // hashed seed
+		pk.UnsignedByte(gameModeSpectator), // game mode
+		pk.Byte(-1),                        // previous game mode
+		pk.Boolean(false),                  // debug world
+		pk.Boolean(true),                   // flat world
+		pk.Boolean(false),                  // death location
+		pk.VarInt(0),                       // portal cooldown
+	)); err != nil {
+		return errors.Wrap(err, "failed to send login")
+	}
+
+	if err := c.WritePacket(pk.Marshal(play.SynchronizePlayerPosition,
+		pk.Double(0), pk.Double(parkingPositionY), pk.Double(0),
+		pk.Float(0), pk.Float(0), // yaw and pitch
+		pk.Byte(0),   // absolute position
+		pk.VarInt(1), // teleport ID
+	)); err != nil {
+		return errors.Wrap(err, "failed to send player position")
+	}
+
+	if c.ProtocolVersion >= ProtocolVersion1_20_3 {
+		if err := c.WritePacket(pk.Marshal(play.GameEvent,
+			pk.UnsignedByte(gameEventStartWaitingForChunks), pk.Float(0),
+		)); err != nil {
+			return errors.Wrap(err, "failed to send game event")
+		}
+	}
+
+	return nil
+}
+
+// KeepAlive sends a keep alive to the client. Responses are consumed
+// by Discard.
+func (p *Parked) KeepAlive() error {
+	p.keepAliveID++
+	return p.c.WritePacket(pk.Marshal(p.packets.KeepAlive, pk.Long(p.keepAliveID)))
+}
+
+// InWorld returns true if the client is parked in the play state, in an
+// empty world, where its status can be shown with ShowStatus.
+func (p *Parked) InWorld() bool {
+	return p.play != nil
+}
+
+// Contains the boss bar actions and style used by ShowStatus.
+const (
+	bossBarActionAdd          = 0
+	bossBarActionUpdateHealth = 2
+	bossBarActionUpdateTitle  = 3
+
+	bossBarColorYellow = 4
+	bossBarNoDivisions = 0
+)
+
+// bossBarID is the UUID of the boss bar shown to parked players.
+var bossBarID = uuid.MustParse("5ec6f1a9-4c1e-4d4b-8a43-3f7b6f0c9b1d")
+
+// ShowStatus shows the provided status, and progress between 0 and 1,
+// in a boss bar. It may only be called if the client is parked in a
+// world, see InWorld.
+func (p *Parked) ShowStatus(status *Chat, progress float32) error {
+	if !p.InWorld() {
+		return fmt.Errorf("protocol version %d can't be shown a boss bar", p.c.ProtocolVersion)
+	}
+
+	title, err := p.chatField(status)
+	if err != nil {
+		return err
+	}
+
+	if !p.bossBar {
+		if err := p.c.WritePacket(pk.Marshal(p.play.BossBar,
+			pk.UUID(bossBarID), pk.VarInt(bossBarActionAdd),
+			title, pk.Float(progress),
+			pk.VarInt(bossBarColorYellow), pk.VarInt(bossBarNoDivisions),
+			pk.UnsignedByte(0), // flags
+		)); err != nil {
+			return err
+		}
+
+		p.bossBar = true
+		return nil
+	}
+
+	if err := p.c.WritePacket(pk.Marshal(p.play.BossBar,
+		pk.UUID(bossBarID), pk.VarInt(bossBarActionUpdateTitle), title,
+	)); err != nil {
+		return err
+	}
+
+	return p.c.WritePacket(pk.Marshal(p.play.BossBar,
+		pk.UUID(bossBarID), pk.VarInt(bossBarActionUpdateHealth), pk.Float(progress),
+	))
+}
+
+// CanTransfer returns true if the client supports being transferred to
+// another server.
+func (p *Parked) CanTransfer() bool {
+	return p.packets.Transfer != -1
+}
+
+// Transfer tells the client to connect to the provided host and port.
+// The client will close the current connection on its own.
+func (p *Parked) Transfer(host string, port uint16) error {
+	if !p.CanTransfer() {
+		return fmt.Errorf("protocol version %d does not support transfers", p.c.ProtocolVersion)
+	}
+
+	return p.c.WritePacket(pk.Marshal(p.packets.Transfer, pk.String(host), pk.VarInt(port)))
+}
+
+// Disconnect sends a disconnect packet to the client with the provided
+// reason.
+func (p *Parked) Disconnect(reason *Chat) error {
+	field, err := p.chatField(reason)
+	if err != nil {
+		return err
+	}
+
+	return p.c.WritePacket(pk.Marshal(p.packets.Disconnect, field))
+}
+
+// chatField returns the field encoding the provided chat component
+// outside of the login state.
+func (p *Parked) chatField(c *Chat) (pk.FieldEncoder, error) {
+	// Starting with 1.20.3, chat components are sent as NBT.
+	if p.c.ProtocolVersion >= ProtocolVersion1_20_3 {
+		return (*nbtChat)(c), nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return pk.String(b), nil
+}
+
+// Discard reads and discards all packets sent by the client until an
+// error occurs, such as the client disconnecting.
+func (p *Parked) Discard() error {
+	for {
+		var packet pk.Packet
+		if err := p.c.ReadPacket(&packet); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+
+	mcnet "github.com/Tnze/go-mc/net"
+	pk "github.com/Tnze/go-mc/net/packet"
+	mcregistry "github.com/Tnze/go-mc/registry"
+	"github.com/google/uuid"
+)
+
+func TestParkLoginSuccess(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		profile         *Profile
+	}{
+		{"offline profile", ProtocolVersion1_21_2, &Profile{
+			ID:   OfflineUUID("Notch"),
+			Name: "Notch",
+		}},
+		{"verified profile", ProtocolVersion1_21_2, &Profile{
+			ID:         uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5"),
+			Name:       "Notch",
+			Properties: []ProfileProperty{{Name: "textures", Value: "e30=", Signature: "c2ln"}},
+		}},
+		{"verified profile with strict error handling", ProtocolVersion1_20_5, &Profile{
+			ID:         uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5"),
+			Name:       "Notch",
+			Properties: []ProfileProperty{{Name: "textures", Value: "e30="}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			got := make(chan *Profile, 1)
+			go func() {
+				defer close(got)
+				conn := mcnet.WrapConn(clientConn)
+
+				var p pk.Packet
+				if err := conn.ReadPacket(&p); err != nil {
+					t.Errorf("failed to read login success: %v", err)
+					return
+				}
+
+				profile, err := scanLoginSuccess(&p, tt.protocolVersion)
+				if err != nil {
+					t.Errorf("failed to scan login success: %v", err)
+					return
+				}
+				got <- profile
+
+				if err := conn.WritePacket(pk.Marshal(packetIDLoginAcknowledged)); err != nil {
+					t.Errorf("failed to write login acknowledged: %v", err)
+				}
+			}()
+
+			c := &Client{Conn: mcnet.WrapConn(serverConn), ProtocolVersion: tt.protocolVersion}
+			if _, err := c.Park(tt.profile); err != nil {
+				t.Fatalf("Park() error = %v", err)
+			}
+
+			profile := <-got
+			if profile == nil {
+				return
+			}
+			if profile.ID != tt.profile.ID || profile.Name != tt.profile.Name || len(profile.Properties) != len(tt.profile.Properties) {
+				t.Fatalf("Park() sent %+v, want %+v", profile, tt.profile)
+			}
+			for i := range profile.Properties {
+				if profile.Properties[i] != tt.profile.Properties[i] {
+					t.Errorf("Park() sent property %+v, want %+v", profile.Properties[i], tt.profile.Properties[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParkInWorld(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		inWorld         bool
+	}{
+		{"1.20.2", ProtocolVersion1_20_2, true},
+		{"1.20.4", ProtocolVersion1_20_3, true},
+		{"1.20.5", ProtocolVersion1_20_5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				conn := mcnet.WrapConn(clientConn)
+
+				var p pk.Packet
+				if err := conn.ReadPacket(&p); err != nil || p.ID != packetIDLoginSuccess {
+					t.Errorf("read packet 0x%X, err = %v, want login success", p.ID, err)
+					return
+				}
+				if err := conn.WritePacket(pk.Marshal(packetIDLoginAcknowledged)); err != nil {
+					t.Errorf("failed to write login acknowledged: %v", err)
+					return
+				}
+				if !tt.inWorld {
+					return
+				}
+
+				acceptSpawn(t, conn, tt.protocolVersion)
+			}()
+
+			c := &Client{Conn: mcnet.WrapConn(serverConn), ProtocolVersion: tt.protocolVersion}
+			parked, err := c.Park(&Profile{ID: OfflineUUID("Notch"), Name: "Notch"})
+			if err != nil {
+				t.Fatalf("Park() error = %v", err)
+			}
+			<-done
+
+			if parked.InWorld() != tt.inWorld {
+				t.Errorf("InWorld() = %v, want %v", parked.InWorld(), tt.inWorld)
+			}
+			if !tt.inWorld {
+				if err := parked.ShowStatus(&Chat{Text: "Starting"}, 0.5); err == nil {
+					t.Error("ShowStatus() error = nil, want an error outside of a world")
+				}
+				return
+			}
+
+			// The boss bar is added once and updated afterwards.
+			actions := make(chan []int32, 1)
+			go func() {
+				conn := mcnet.WrapConn(clientConn)
+				var got []int32
+				for range 3 {
+					var p pk.Packet
+					var id pk.UUID
+					var action pk.VarInt
+					if err := conn.ReadPacket(&p); err != nil || p.ID != 0x0A {
+						t.Errorf("read packet 0x%X, err = %v, want boss bar", p.ID, err)
+						break
+					}
+					if err := p.Scan(&id, &action); err != nil {
+						t.Errorf("failed to scan boss bar: %v", err)
+						break
+					}
+					got = append(got, int32(action))
+				}
+				actions <- got
+			}()
+
+			for _, progress := range []float32{0, 0.5} {
+				if err := parked.ShowStatus(&Chat{Text: "Starting"}, progress); err != nil {
+					t.Fatalf("ShowStatus() error = %v", err)
+				}
+			}
+			if got := <-actions; !slices.Equal(got, []int32{0, 3, 2}) {
+				t.Errorf("ShowStatus() sent boss bar actions %v, want [0 3 2]", got)
+			}
+		})
+	}
+}
+
+// acceptSpawn plays the client's side of being spawned in the parking
+// world, starting in the configuration state.
+func acceptSpawn(t *testing.T, conn *mcnet.Conn, protocolVersion int32) {
+	t.Helper()
+
+	var p pk.Packet
+	if err := conn.ReadPacket(&p); err != nil || p.ID != 0x05 {
+		t.Errorf("read packet 0x%X, err = %v, want registry data", p.ID, err)
+		return
+	}
+	var codec mcregistry.NetworkCodec
+	if err := p.Scan(pk.NBTField{V: &codec, AllowUnknownFields: true}); err != nil {
+		t.Errorf("failed to decode registry data: %v", err)
+		return
+	}
+	if id, _ := codec.DimensionType.Find(parkingDimension); id == -1 {
+		t.Errorf("registry data has no %s dimension type", parkingDimension)
+	}
+	if id, _ := codec.DamageType.Find("minecraft:generic"); id == -1 {
+		t.Error("registry data has no generic damage type")
+	}
+
+	if err := conn.ReadPacket(&p); err != nil || p.ID != 0x02 {
+		t.Errorf("read packet 0x%X, err = %v, want finish configuration", p.ID, err)
+		return
+	}
+	// Clients send their settings before acknowledging.
+	if err := conn.WritePacket(pk.Marshal(0x00, pk.String("en_us"))); err != nil {
+		t.Errorf("failed to write client information: %v", err)
+		return
+	}
+	if err := conn.WritePacket(pk.Marshal(0x02)); err != nil {
+		t.Errorf("failed to write finish configuration acknowledgement: %v", err)
+		return
+	}
+
+	// Login, player position and, for 1.20.3+, the game event.
+	want := []int32{0x29, 0x3E}
+	if protocolVersion >= ProtocolVersion1_20_3 {
+		want = append(want, 0x20)
+	}
+	for _, id := range want {
+		if err := conn.ReadPacket(&p); err != nil || p.ID != id {
+			t.Errorf("read packet 0x%X, err = %v, want 0x%X", p.ID, err, id)
+			return
+		}
+	}
+}
+
+// scanLoginSuccess decodes the profile sent in a login success packet.
+func scanLoginSuccess(p *pk.Packet, protocolVersion int32) (*Profile, error) {
+	var id pk.UUID
+	var name pk.String
+	r := bytes.NewReader(p.Data)
+	for _, f := range []pk.FieldDecoder{&id, &name} {
+		if _, err := f.ReadFrom(r); err != nil {
+			return nil, err
+		}
+	}
+
+	var n pk.VarInt
+	if _, err := n.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{ID: uuid.UUID(id), Name: string(name)}
+	for range int(n) {
+		var propName, value, signature pk.String
+		var signed pk.Boolean
+		for _, f := range []pk.FieldDecoder{&propName, &value, &signed} {
+			if _, err := f.ReadFrom(r); err != nil {
+				return nil, err
+			}
+		}
+		if signed {
+			if _, err := signature.ReadFrom(r); err != nil {
+				return nil, err
+			}
+		}
+		profile.Properties = append(profile.Properties, ProfileProperty{
+			Name: string(propName), Value: string(value), Signature: string(signature),
+		})
+	}
+
+	if protocolVersion >= ProtocolVersion1_20_5 && protocolVersion < ProtocolVersion1_21_2 {
+		var strict pk.Boolean
+		if _, err := strict.ReadFrom(r); err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"crypto/md5" //nolint:gosec // Why: Offline UUIDs are defined as MD5.
+
+	"github.com/google/uuid"
+)
+
+// Contains protocol versions that changed the packets the proxy sends
+// or receives.
+//
+// See: https://wiki.vg/Protocol_version_numbers
+const (
+	// ProtocolVersion1_19 added the signature data to login start.
+	ProtocolVersion1_19 int32 = 759
+
+	// ProtocolVersion1_19_1 added the optional player UUID to login
+	// start.
+	ProtocolVersion1_19_1 int32 = 760
+
+	// ProtocolVersion1_19_3 removed the signature data from login start.
+	ProtocolVersion1_19_3 int32 = 761
+
+	// ProtocolVersion1_20_2 introduced the configuration state and made
+	// the player UUID in login start mandatory.
+	ProtocolVersion1_20_2 int32 = 764
+
+	// ProtocolVersion1_20_3 changed chat components sent outside of the
+	// login state to be encoded as NBT.
+	ProtocolVersion1_20_3 int32 = 765
+
+	// ProtocolVersion1_20_5 introduced the transfer packet and the
+	// strict error handling field in login success.
+	ProtocolVersion1_20_5 int32 = 766
+
+	// ProtocolVersion1_21_2 removed the strict error handling field in
+	// login success.
+	ProtocolVersion1_21_2 int32 = 768
+)
+
+// Contains packet IDs that are the same across all supported protocol
+// versions.
+const (
+	// packetIDLoginSuccess is the clientbound login success packet.
+	packetIDLoginSuccess int32 = 0x02
+
+	// packetIDLoginAcknowledged is the serverbound login acknowledged
+	// packet, sent when the client enters the configuration state.
+	packetIDLoginAcknowledged int32 = 0x03
+)
+
+// parkedPackets contains the IDs of packets sent to parked clients,
+// whether they're parked in the configuration or in the play state. A
+// value of -1 denotes the packet doesn't exist in that version of the
+// protocol.
+type parkedPackets struct {
+	// Disconnect is the clientbound disconnect packet.
+	Disconnect int32
+
+	// KeepAlive is the clientbound keep alive packet.
+	KeepAlive int32
+
+	// Transfer is the clientbound transfer packet.
+	Transfer int32
+}
+
+// configurationPackets contains the IDs of packets the proxy uses in
+// the configuration state.
+type configurationPackets struct {
+	parkedPackets
+
+	// RegistryData is the clientbound registry data packet.
+	RegistryData int32
+
+	// FinishConfiguration is the clientbound finish configuration
+	// packet, moving the client to the play state.
+	FinishConfiguration int32
+
+	// AcknowledgeFinishConfiguration is the serverbound packet
+	// acknowledging FinishConfiguration.
+	AcknowledgeFinishConfiguration int32
+}
+
+// configurationPacketTable maps protocol versions to the configuration
+// state packets they use. Entries are sorted by descending protocol
+// version, the first entry that is less than or equal to the client's
+// protocol version is used.
+var configurationPacketTable = []struct {
+	minVersion int32
+	packets    configurationPackets
+}{
+	{ProtocolVersion1_20_5, configurationPackets{
+		parkedPackets:                  parkedPackets{Disconnect: 0x02, KeepAlive: 0x04, Transfer: 0x0B},
+		RegistryData:                   0x07,
+		FinishConfiguration:            0x03,
+		AcknowledgeFinishConfiguration: 0x03,
+	}},
+	{ProtocolVersion1_20_2, configurationPackets{
+		parkedPackets:                  parkedPackets{Disconnect: 0x01, KeepAlive: 0x03, Transfer: -1},
+		RegistryData:                   0x05,
+		FinishConfiguration:            0x02,
+		AcknowledgeFinishConfiguration: 0x02,
+	}},
+}
+
+// getConfigurationPackets returns the configuration state packets for
+// the provided protocol version. False is returned if the version
+// doesn't have a configuration state.
+func getConfigurationPackets(protocolVersion int32) (configurationPackets, bool) {
+	for _, e := range configurationPacketTable {
+		if protocolVersion >= e.minVersion {
+			return e.packets, true
+		}
+	}
+
+	return configurationPackets{}, false
+}
+
+// playPackets contains the IDs of packets the proxy uses in the play
+// state.
+type playPackets struct {
+	parkedPackets
+
+	// Login is the clientbound login (play) packet, spawning the player
+	// in a world.
+	Login int32
+
+	// SynchronizePlayerPosition is the clientbound packet teleporting
+	// the player.
+	SynchronizePlayerPosition int32
+
+	// GameEvent is the clientbound game event packet.
+	GameEvent int32
+
+	// BossBar is the clientbound boss bar packet.
+	BossBar int32
+}
+
+// playPacketTable maps protocol versions to the play state packets they
+// use. Entries are sorted by descending protocol version, the first
+// entry that is less than or equal to the client's protocol version is
+// used. Versions newer than the last supported one aren't in the table
+// at all, see maxPlayProtocolVersion.
+//
+// See: https://minecraft.wiki/w/Java_Edition_protocol
+var playPacketTable = []struct {
+	minVersion int32
+	packets    playPackets
+}{
+	{ProtocolVersion1_20_2, playPackets{
+		parkedPackets:             parkedPackets{Disconnect: 0x1B, KeepAlive: 0x24, Transfer: -1},
+		Login:                     0x29,
+		SynchronizePlayerPosition: 0x3E,
+		GameEvent:                 0x20,
+		BossBar:                   0x0A,
+	}},
+}
+
+// maxPlayProtocolVersion is the newest protocol version, that of 1.20.3
+// and 1.20.4, that can be parked in the play state. Starting with 1.20.5, registries are
+// negotiated through known packs and have to be sent one by one, which
+// isn't implemented.
+const maxPlayProtocolVersion = ProtocolVersion1_20_3
+
+// getPlayPackets returns the play state packets for the provided
+// protocol version. False is returned if the version can't be parked in
+// the play state.
+func getPlayPackets(protocolVersion int32) (playPackets, bool) {
+	if protocolVersion > maxPlayProtocolVersion {
+		return playPackets{}, false
+	}
+
+	for _, e := range playPacketTable {
+		if protocolVersion >= e.minVersion {
+			return e.packets, true
+		}
+	}
+
+	return playPackets{}, false
+}
+
+// OfflineUUID returns the UUID a server in offline mode would assign to
+// the provided player name.
+func OfflineUUID(name string) uuid.UUID {
+	//nolint:gosec // Why: Offline UUIDs are defined as MD5.
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = (sum[6] & 0x0f) | 0x30 // version 3
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return uuid.UUID(sum)
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+// Contains the dimension and biome the parking world is made of.
+const (
+	// parkingDimension is the dimension type and name of the parking
+	// world.
+	parkingDimension = "minecraft:overworld"
+
+	// parkingBiome is the biome of the parking world. Clients fall back
+	// to plains for chunks they don't have, so it has to exist.
+	parkingBiome = "minecraft:plains"
+)
+
+// registryCodec contains the registries sent to 1.20.2 to 1.20.4
+// clients in the registry data packet, before they may enter the play
+// state. Only what's needed to spawn a player in an empty world is
+// included.
+type registryCodec struct {
+	DimensionType registry[dimensionType] `nbt:"minecraft:dimension_type"`
+	Biome         registry[biome]         `nbt:"minecraft:worldgen/biome"`
+	DamageType    registry[damageType]    `nbt:"minecraft:damage_type"`
+	ChatType      registry[struct{}]      `nbt:"minecraft:chat_type"`
+	TrimPattern   registry[struct{}]      `nbt:"minecraft:trim_pattern"`
+	TrimMaterial  registry[struct{}]      `nbt:"minecraft:trim_material"`
+}
+
+// registry is a registry in a registryCodec.
+type registry[E any] struct {
+	Type  string             `nbt:"type"`
+	Value []registryEntry[E] `nbt:"value"`
+}
+
+// registryEntry is an entry of a registry.
+type registryEntry[E any] struct {
+	Name    string `nbt:"name"`
+	ID      int32  `nbt:"id"`
+	Element E      `nbt:"element"`
+}
+
+// dimensionType is an entry of the dimension type registry.
+type dimensionType struct {
+	FixedTime                   int64   `nbt:"fixed_time"`
+	HasSkylight                 bool    `nbt:"has_skylight"`
+	HasCeiling                  bool    `nbt:"has_ceiling"`
+	Ultrawarm                   bool    `nbt:"ultrawarm"`
+	Natural                     bool    `nbt:"natural"`
+	CoordinateScale             float64 `nbt:"coordinate_scale"`
+	BedWorks                    bool    `nbt:"bed_works"`
+	RespawnAnchorWorks          bool    `nbt:"respawn_anchor_works"`
+	MinY                        int32   `nbt:"min_y"`
+	Height                      int32   `nbt:"height"`
+	LogicalHeight               int32   `nbt:"logical_height"`
+	Infiniburn                  string  `nbt:"infiniburn"`
+	Effects                     string  `nbt:"effects"`
+	AmbientLight                float32 `nbt:"ambient_light"`
+	PiglinSafe                  bool    `nbt:"piglin_safe"`
+	HasRaids                    bool    `nbt:"has_raids"`
+	MonsterSpawnLightLevel      int32   `nbt:"monster_spawn_light_level"`
+	MonsterSpawnBlockLightLimit int32   `nbt:"monster_spawn_block_light_limit"`
+}
+
+// biome is an entry of the biome registry.
+type biome struct {
+	HasPrecipitation bool         `nbt:"has_precipitation"`
+	Temperature      float32      `nbt:"temperature"`
+	Downfall         float32      `nbt:"downfall"`
+	Effects          biomeEffects `nbt:"effects"`
+}
+
+// biomeEffects are the colours of a biome.
+type biomeEffects struct {
+	SkyColor      int32 `nbt:"sky_color"`
+	FogColor      int32 `nbt:"fog_color"`
+	WaterColor    int32 `nbt:"water_color"`
+	WaterFogColor int32 `nbt:"water_fog_color"`
+}
+
+// damageType is an entry of the damage type registry.
+type damageType struct {
+	MessageID  string  `nbt:"message_id"`
+	Scaling    string  `nbt:"scaling"`
+	Exhaustion float32 `nbt:"exhaustion"`
+}
+
+// damageTypes contains the names, and message IDs, of the damage types
+// clients look up when they create a world. Clients only need the ones
+// of their version, but entries they don't know of are harmless, so the
+// damage types of all versions that can be parked in the play state are
+// included.
+var damageTypes = []struct{ name, messageID string }{
+	{"minecraft:arrow", "arrow"},
+	{"minecraft:bad_respawn_point", "badRespawnPoint"},
+	{"minecraft:cactus", "cactus"},
+	{"minecraft:cramming", "cramming"},
+	{"minecraft:dragon_breath", "dragonBreath"},
+	{"minecraft:drown", "drown"},
+	{"minecraft:dry_out", "dryout"},
+	{"minecraft:explosion", "explosion"},
+	{"minecraft:fall", "fall"},
+	{"minecraft:falling_anvil", "anvil"},
+	{"minecraft:falling_block", "fallingBlock"},
+	{"minecraft:falling_stalactite", "fallingStalactite"},
+	{"minecraft:fireball", "fireball"},
+	{"minecraft:fireworks", "fireworks"},
+	{"minecraft:fly_into_wall", "flyIntoWall"},
+	{"minecraft:freeze", "freeze"},
+	{"minecraft:generic", "generic"},
+	{"minecraft:generic_kill", "genericKill"},
+	{"minecraft:hot_floor", "hotFloor"},
+	{"minecraft:in_fire", "inFire"},
+	{"minecraft:in_wall", "inWall"},
+	{"minecraft:indirect_magic", "indirectMagic"},
+	{"minecraft:lava", "lava"},
+	{"minecraft:lightning_bolt", "lightningBolt"},
+	{"minecraft:magic", "magic"},
+	{"minecraft:mob_attack", "mob"},
+	{"minecraft:mob_attack_no_aggro", "mob"},
+	{"minecraft:mob_projectile", "mob"},
+	{"minecraft:on_fire", "onFire"},
+	{"minecraft:out_of_world", "outOfWorld"},
+	{"minecraft:outside_border", "outsideBorder"},
+	{"minecraft:player_attack", "player"},
+	{"minecraft:player_explosion", "explosion.player"},
+	{"minecraft:sonic_boom", "sonic_boom"},
+	{"minecraft:stalagmite", "stalagmite"},
+	{"minecraft:starve", "starve"},
+	{"minecraft:sting", "sting"},
+	{"minecraft:sweet_berry_bush", "sweetBerryBush"},
+	{"minecraft:thorns", "thorns"},
+	{"minecraft:thrown", "thrown"},
+	{"minecraft:trident", "trident"},
+	{"minecraft:unattributed_fireball", "onFire"},
+	{"minecraft:wither", "wither"},
+	{"minecraft:wither_skull", "witherSkull"},
+}
+
+// parkingRegistries returns the registries of the parking world: an
+// overworld that's always day, made of a single biome.
+func parkingRegistries() *registryCodec {
+	codec := &registryCodec{
+		DimensionType: registry[dimensionType]{
+			Type: "minecraft:dimension_type",
+			Value: []registryEntry[dimensionType]{{
+				Name: parkingDimension,
+				Element: dimensionType{
+					FixedTime:       6000, // noon
+					HasSkylight:     true,
+					Natural:         true,
+					CoordinateScale: 1,
+					BedWorks:        true,
+					MinY:            -64,
+					Height:          384,
+					LogicalHeight:   384,
+					Infiniburn:      "#minecraft:infiniburn_overworld",
+					Effects:         "minecraft:overworld",
+				},
+			}},
+		},
+		Biome: registry[biome]{
+			Type: "minecraft:worldgen/biome",
+			Value: []registryEntry[biome]{{
+				Name: parkingBiome,
+				Element: biome{
+					HasPrecipitation: true,
+					Temperature:      0.8,
+					Downfall:         0.4,
+					Effects: biomeEffects{
+						SkyColor:      0x78A7FF,
+						FogColor:      0xC0D8FF,
+						WaterColor:    0x3F76E4,
+						WaterFogColor: 0x050533,
+					},
+				},
+			}},
+		},
+		DamageType:   registry[damageType]{Type: "minecraft:damage_type"},
+		ChatType:     registry[struct{}]{Type: "minecraft:chat_type"},
+		TrimPattern:  registry[struct{}]{Type: "minecraft:trim_pattern"},
+		TrimMaterial: registry[struct{}]{Type: "minecraft:trim_material"},
+	}
+
+	for i, t := range damageTypes {
+		codec.DamageType.Value = append(codec.DamageType.Value, registryEntry[damageType]{
+			Name:    t.name,
+			ID:      int32(i), //nolint:gosec // Why: There are only a few damage types.
+			Element: damageType{MessageID: t.messageID, Scaling: "never", Exhaustion: 0.1},
+		})
+	}
+
+	return codec
+}
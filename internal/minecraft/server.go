@@ -18,6 +18,7 @@ package minecraft
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/Tnze/go-mc/bot"
@@ -27,10 +28,10 @@ import (
 
 // Status contains the status of the minecraft server.
 type Status struct {
-	Version     *StatusVersion     `json:"version"`
-	Players     *StatusPlayers     `json:"players"`
-	Description *StatusDescription `json:"description"`
-	Favicon     string             `json:"favicon"`
+	Version     *StatusVersion `json:"version"`
+	Players     *StatusPlayers `json:"players"`
+	Description *Chat          `json:"description"`
+	Favicon     string         `json:"favicon,omitempty"`
 }
 
 // StatusVersion contains the version and protocol information of the
@@ -47,19 +48,15 @@ type StatusPlayers struct {
 	Sample []interface{} `json:"sample"`
 }
 
-// StatusDescription contains the description of the minecraft server.
-type StatusDescription struct {
-	Text string `json:"text"`
+// NewListener wraps an existing listener as a minecraft listener.
+func NewListener(l net.Listener) *mcnet.Listener {
+	return &mcnet.Listener{Listener: l}
 }
 
-// ListenMC listens on a minecraft port
-func ListenMC(addr string) (*mcnet.Listener, error) {
-	return mcnet.ListenMC(addr)
-}
-
-// GetServerStatus returns a server's status
-func GetServerStatus(addr string, port uint) (*Status, error) {
-	b, _, err := bot.PingAndListTimeout(fmt.Sprintf("%s:%d", addr, port), time.Second*30)
+// GetServerStatus returns a server's status. An error is returned if
+// the server doesn't answer within the provided timeout.
+func GetServerStatus(addr string, port uint, timeout time.Duration) (*Status, error) {
+	b, _, err := bot.PingAndListTimeout(fmt.Sprintf("%s:%d", addr, port), timeout)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to ping server")
 	}
@@ -0,0 +1,127 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+)
+
+// Contains packet IDs used for Velocity's modern forwarding, which
+// happens in the login state.
+const (
+	// packetIDLoginPluginRequest is the clientbound login plugin request
+	// packet.
+	packetIDLoginPluginRequest int32 = 0x04
+
+	// packetIDLoginPluginResponse is the serverbound login plugin
+	// response packet.
+	packetIDLoginPluginResponse int32 = 0x02
+)
+
+// velocityPlayerInfoChannel is the login plugin channel servers use to
+// request forwarding information.
+const velocityPlayerInfoChannel = "velocity:player_info"
+
+// velocityForwardingVersion is the version of the forwarding payload we
+// send. Version 1 (MODERN_DEFAULT) is supported by all servers, newer
+// versions only add the player's chat signing key.
+const velocityForwardingVersion = 1
+
+// VelocityForwarding contains the information forwarded to a server
+// using Velocity's modern forwarding.
+//
+// See: https://docs.papermc.io/velocity/player-information-forwarding
+type VelocityForwarding struct {
+	// Secret is the secret shared with the server, used to sign the
+	// forwarded information.
+	Secret []byte
+
+	// ClientIP is the IP address of the original client.
+	ClientIP string
+
+	// UUID is the UUID of the player.
+	UUID uuid.UUID
+
+	// Name is the name of the player.
+	Name string
+
+	// Properties contains the player's properties, such as their skin.
+	Properties []ProfileProperty
+}
+
+// ParseVelocityForwardingRequest returns the message ID of the provided
+// packet if it's a request for Velocity forwarding information. False
+// is returned if the packet is anything else.
+func ParseVelocityForwardingRequest(p *pk.Packet) (int32, bool) {
+	if p.ID != packetIDLoginPluginRequest {
+		return 0, false
+	}
+
+	var messageID pk.VarInt
+	var channel pk.Identifier
+	if err := p.Scan(&messageID, &channel); err != nil {
+		return 0, false
+	}
+	if channel != velocityPlayerInfoChannel {
+		return 0, false
+	}
+
+	return int32(messageID), true
+}
+
+// Response returns the login plugin response answering the Velocity
+// forwarding request with the provided message ID.
+func (f *VelocityForwarding) Response(messageID int32) (pk.Packet, error) {
+	fields := []pk.FieldEncoder{
+		pk.VarInt(velocityForwardingVersion),
+		pk.String(f.ClientIP),
+		pk.UUID(f.UUID),
+		pk.String(f.Name),
+	}
+	fields = append(fields, propertyFields(f.Properties)...)
+
+	var payload bytes.Buffer
+	for _, field := range fields {
+		if _, err := field.WriteTo(&payload); err != nil {
+			return pk.Packet{}, err
+		}
+	}
+
+	mac := hmac.New(sha256.New, f.Secret)
+	mac.Write(payload.Bytes())
+
+	return pk.Marshal(
+		packetIDLoginPluginResponse,
+		pk.VarInt(messageID),
+		pk.Boolean(true),
+		rawBytes(append(mac.Sum(nil), payload.Bytes()...)),
+	), nil
+}
+
+// rawBytes are bytes written as-is, without a length prefix.
+type rawBytes []byte
+
+// WriteTo implements pk.FieldEncoder.
+func (b rawBytes) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b)
+	return int64(n), err
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package minecraft
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/google/uuid"
+)
+
+func TestParseVelocityForwardingRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet pk.Packet
+		wantID int32
+		wantOk bool
+	}{
+		{
+			name:   "forwarding request",
+			packet: pk.Marshal(packetIDLoginPluginRequest, pk.VarInt(42), pk.Identifier(velocityPlayerInfoChannel), pk.Byte(4)),
+			wantID: 42,
+			wantOk: true,
+		},
+		{
+			name:   "other channel",
+			packet: pk.Marshal(packetIDLoginPluginRequest, pk.VarInt(42), pk.Identifier("minecraft:brand")),
+		},
+		{
+			name:   "other packet",
+			packet: pk.Marshal(packetIDLoginSuccess, pk.VarInt(42), pk.Identifier(velocityPlayerInfoChannel)),
+		},
+		{
+			name:   "truncated",
+			packet: pk.Marshal(packetIDLoginPluginRequest, pk.VarInt(42)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := ParseVelocityForwardingRequest(&tt.packet)
+			if id != tt.wantID || ok != tt.wantOk {
+				t.Errorf("ParseVelocityForwardingRequest() = %d, %v, want %d, %v", id, ok, tt.wantID, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestVelocityForwardingResponse(t *testing.T) {
+	f := &VelocityForwarding{
+		Secret:   []byte("secret"),
+		ClientIP: "192.0.2.1",
+		UUID:     uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5"),
+		Name:     "Notch",
+		Properties: []ProfileProperty{
+			{Name: "textures", Value: "e30=", Signature: "c2ln"},
+			{Name: "unsigned", Value: "e30="},
+		},
+	}
+
+	p, err := f.Response(7)
+	if err != nil {
+		t.Fatalf("Response() error = %v", err)
+	}
+	if p.ID != packetIDLoginPluginResponse {
+		t.Fatalf("Response() packet ID = 0x%X, want 0x%X", p.ID, packetIDLoginPluginResponse)
+	}
+
+	r := bytes.NewReader(p.Data)
+	var messageID pk.VarInt
+	var successful pk.Boolean
+	for _, field := range []pk.FieldDecoder{&messageID, &successful} {
+		if _, err := field.ReadFrom(r); err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+	}
+	if messageID != 7 || !successful {
+		t.Fatalf("Response() message ID = %d, successful = %v, want 7, true", messageID, successful)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < sha256.Size {
+		t.Fatalf("Response() data is %d bytes, too short for a signature", len(data))
+	}
+
+	// The server checks the payload is signed with the shared secret.
+	signature, payload := data[:sha256.Size], data[sha256.Size:]
+	mac := hmac.New(sha256.New, f.Secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Error("Response() signature doesn't match the payload")
+	}
+
+	r = bytes.NewReader(payload)
+	var (
+		version       pk.VarInt
+		clientIP      pk.String
+		id            pk.UUID
+		name          pk.String
+		numProperties pk.VarInt
+	)
+	for _, field := range []pk.FieldDecoder{&version, &clientIP, &id, &name, &numProperties} {
+		if _, err := field.ReadFrom(r); err != nil {
+			t.Fatalf("failed to read payload: %v", err)
+		}
+	}
+	if version != velocityForwardingVersion || string(clientIP) != f.ClientIP || uuid.UUID(id) != f.UUID || string(name) != f.Name {
+		t.Errorf("Response() payload = %d, %q, %s, %q, want %d, %q, %s, %q",
+			version, clientIP, uuid.UUID(id), name, velocityForwardingVersion, f.ClientIP, f.UUID, f.Name)
+	}
+	if int(numProperties) != len(f.Properties) {
+		t.Fatalf("Response() has %d properties, want %d", numProperties, len(f.Properties))
+	}
+
+	for _, want := range f.Properties {
+		var propName, value, signature pk.String
+		var hasSignature pk.Boolean
+		for _, field := range []pk.FieldDecoder{&propName, &value, &hasSignature} {
+			if _, err := field.ReadFrom(r); err != nil {
+				t.Fatalf("failed to read property: %v", err)
+			}
+		}
+		if hasSignature {
+			if _, err := signature.ReadFrom(r); err != nil {
+				t.Fatalf("failed to read property signature: %v", err)
+			}
+		}
+
+		got := ProfileProperty{Name: string(propName), Value: string(value), Signature: string(signature)}
+		if got != want {
+			t.Errorf("Response() property = %+v, want %+v", got, want)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("Response() payload has %d trailing bytes", r.Len())
+	}
+}
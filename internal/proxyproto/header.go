@@ -0,0 +1,109 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// ParseVersion parses a version as written in configuration, either
+// "v1" or "v2".
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "v1":
+		return V1, nil
+	case "v2":
+		return V2, nil
+	default:
+		return 0, fmt.Errorf("unknown PROXY protocol version %q", s)
+	}
+}
+
+// Format returns the header encoded in its version of the protocol. If
+// either address isn't a TCP address, the header is encoded without
+// addresses.
+func (h *Header) Format() ([]byte, error) {
+	src, srcOk := h.Source.(*net.TCPAddr)
+	dst, dstOk := h.Destination.(*net.TCPAddr)
+	hasAddrs := srcOk && dstOk
+
+	// Use IPv4 only if both addresses are IPv4, otherwise send both as
+	// IPv6 (mapping IPv4 addresses if needed).
+	var srcIP, dstIP net.IP
+	if hasAddrs {
+		srcIP, dstIP = src.IP.To4(), dst.IP.To4()
+		if srcIP == nil || dstIP == nil {
+			srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		}
+	}
+
+	switch h.Version {
+	case V1:
+		if !hasAddrs {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+
+		if len(srcIP) == net.IPv4len {
+			return fmt.Appendf(nil, "PROXY TCP4 %s %s %d %d\r\n", srcIP, dstIP, src.Port, dst.Port), nil
+		}
+		return fmt.Appendf(nil, "PROXY TCP6 %s %s %d %d\r\n", formatIPv6(srcIP), formatIPv6(dstIP), src.Port, dst.Port), nil
+	case V2:
+		b := append([]byte{}, v2Signature...)
+		if !hasAddrs {
+			// version 2, LOCAL command, unspecified family, no addresses
+			return append(b, 0x20, 0x00, 0x00, 0x00), nil
+		}
+
+		family := byte(0x11) // TCP over IPv4
+		if len(srcIP) == net.IPv6len {
+			family = 0x21 // TCP over IPv6
+		}
+
+		// version 2, PROXY command
+		b = append(b, 0x21, family)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(srcIP)*2+4)) //nolint:gosec // Why: At most 36.
+		b = append(b, srcIP...)
+		b = append(b, dstIP...)
+		b = binary.BigEndian.AppendUint16(b, uint16(src.Port)) //nolint:gosec // Why: Ports fit in 16 bits.
+		b = binary.BigEndian.AppendUint16(b, uint16(dst.Port)) //nolint:gosec // Why: Ports fit in 16 bits.
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown PROXY protocol version %d", h.Version)
+	}
+}
+
+// formatIPv6 formats an IP address in IPv6 notation, including IPv4
+// mapped addresses which net.IP would otherwise format as IPv4.
+func formatIPv6(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// WriteTo writes the encoded header to the provided writer.
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.Format()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
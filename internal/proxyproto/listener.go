@@ -0,0 +1,131 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"net"
+	"sync"
+)
+
+// Listener is a net.Listener that expects connections from trusted
+// sources to start with a PROXY protocol header. Connections from
+// untrusted sources are passed through as-is, so clients can't spoof
+// their address.
+type Listener struct {
+	net.Listener
+
+	// Trusted is the list of networks that are allowed to send a PROXY
+	// protocol header. If empty, no sources are trusted.
+	Trusted []*net.IPNet
+}
+
+// Accept accepts a connection. The PROXY protocol header is read lazily
+// on the first call to Read, RemoteAddr or LocalAddr, so that a slow
+// sender doesn't block accepting other connections. Callers should set
+// a read deadline before using the connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	return &Conn{Conn: conn}, nil
+}
+
+// isTrusted returns true if the provided address is allowed to send a
+// PROXY protocol header.
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range l.Trusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Conn is a net.Conn that starts with a PROXY protocol header. The
+// addresses from the header are returned by RemoteAddr and LocalAddr.
+type Conn struct {
+	net.Conn
+
+	// once ensures the header is only read once.
+	once sync.Once
+
+	// header is the header read from the connection, if there was one.
+	header *Header
+
+	// err is the error that occurred while reading the header, if any.
+	// It is returned by all calls to Read.
+	err error
+}
+
+// readHeader reads the header from the underlying connection.
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.header, c.err = ReadHeader(c.Conn)
+	})
+}
+
+// Header returns the PROXY protocol header sent on the connection,
+// reading it if it hasn't been read yet.
+func (c *Conn) Header() (*Header, error) {
+	c.readHeader()
+	return c.header, c.err
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr returns the address of the original client. If the header
+// couldn't be read, or didn't contain an address, the address of the
+// sender is returned instead.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the original client connected to. If
+// the header couldn't be read, or didn't contain an address, the local
+// address of the connection is returned instead.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,195 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package proxyproto implements the HAProxy PROXY protocol, versions 1
+// and 2, which load balancers use to pass along the original address
+// of a client.
+//
+// See: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of the PROXY protocol.
+type Version int
+
+// Contains all of the supported PROXY protocol versions.
+const (
+	// V1 is the human-readable version of the protocol.
+	V1 Version = 1
+
+	// V2 is the binary version of the protocol.
+	V2 Version = 2
+)
+
+// v2Signature is the signature every v2 header starts with.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1MaxLength is the maximum length of a v1 header, including the
+// trailing CRLF.
+const v1MaxLength = 107
+
+// Header is a PROXY protocol header.
+type Header struct {
+	// Version is the version of the protocol the header was sent with.
+	Version Version
+
+	// Source is the address of the original client. This is nil if
+	// the sender didn't provide an address, such as for health checks.
+	Source net.Addr
+
+	// Destination is the address the original client connected to.
+	// This is nil if the sender didn't provide an address.
+	Destination net.Addr
+}
+
+// ReadHeader reads a PROXY protocol header from the provided reader.
+// Only the bytes that make up the header are consumed.
+func ReadHeader(r io.Reader) (*Header, error) {
+	// The shortest valid v1 header is longer than the v2 signature, so
+	// it's always safe to read this much.
+	prefix := make([]byte, len(v2Signature))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(prefix, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(prefix, []byte("PROXY ")):
+		return readV1(r, prefix)
+	default:
+		return nil, fmt.Errorf("connection did not start with a PROXY protocol header")
+	}
+}
+
+// readV1 reads the remainder of a v1 header. The provided prefix is the
+// data already read from the header.
+func readV1(r io.Reader, prefix []byte) (*Header, error) {
+	line := prefix
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("v1 header is too long")
+		}
+
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("failed to read v1 header: %w", err)
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	h := &Header{Version: V1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid v1 header %q", line)
+	}
+
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("unsupported v1 protocol %q", fields[1])
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source address: %w", err)
+	}
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 destination address: %w", err)
+	}
+
+	h.Source = src
+	h.Destination = dst
+	return h, nil
+}
+
+// parseV1Addr parses an address and port from a v1 header.
+func parseV1Addr(addr, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", addr)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 reads the remainder of a v2 header, after the signature.
+func readV2(r io.Reader) (*Header, error) {
+	// version and command, address family and protocol, length
+	meta := make([]byte, 4)
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, fmt.Errorf("failed to read v2 header: %w", err)
+	}
+
+	if meta[0]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", meta[0]>>4)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(meta[2:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read v2 addresses: %w", err)
+	}
+
+	h := &Header{Version: V2}
+
+	// LOCAL connections, such as health checks from the sender, don't
+	// carry an address.
+	if meta[0]&0x0F == 0x00 {
+		return h, nil
+	}
+
+	var ipLen int
+	switch meta[1] {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		// Other families are allowed, but carry no usable address.
+		return h, nil
+	}
+
+	if len(data) < ipLen*2+4 {
+		return nil, fmt.Errorf("v2 address block is too short")
+	}
+
+	h.Source = &net.TCPAddr{
+		IP:   net.IP(data[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(data[ipLen*2:])),
+	}
+	h.Destination = &net.TCPAddr{
+		IP:   net.IP(data[ipLen : ipLen*2]),
+		Port: int(binary.BigEndian.Uint16(data[ipLen*2+2:])),
+	}
+
+	// Any remaining data are TLVs, which we don't use.
+	return h, nil
+}
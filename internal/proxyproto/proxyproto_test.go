@@ -0,0 +1,340 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2 builds a v2 header from the signature and the provided bytes.
+func v2(b ...byte) string {
+	return string(v2Signature) + string(b)
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *Header
+		wantErr string
+	}{
+		{
+			name:  "v1 TCP4",
+			input: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 25565\r\n",
+			want: &Header{
+				Version:     V1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 25565},
+			},
+		},
+		{
+			name:  "v1 TCP6",
+			input: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 25565\r\n",
+			want: &Header{
+				Version:     V1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 25565},
+			},
+		},
+		{
+			name:  "v1 UNKNOWN",
+			input: "PROXY UNKNOWN ignored\r\n",
+			want:  &Header{Version: V1},
+		},
+		{
+			name:    "v1 truncated",
+			input:   "PROXY TCP4 192.0.2.1",
+			wantErr: "failed to read v1 header",
+		},
+		{
+			name:    "v1 too long",
+			input:   "PROXY TCP4 " + strings.Repeat("1", v1MaxLength) + "\r\n",
+			wantErr: "v1 header is too long",
+		},
+		{
+			name:    "v1 missing fields",
+			input:   "PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+			wantErr: "invalid v1 header",
+		},
+		{
+			name:    "v1 unsupported protocol",
+			input:   "PROXY UDP4 192.0.2.1 198.51.100.1 56324 25565\r\n",
+			wantErr: "unsupported v1 protocol",
+		},
+		{
+			name:    "v1 invalid port",
+			input:   "PROXY TCP4 192.0.2.1 198.51.100.1 65536 25565\r\n",
+			wantErr: "invalid v1 source address",
+		},
+		{
+			name:  "v2 TCP over IPv4",
+			input: v2(0x21, 0x11, 0x00, 0x0C, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x63, 0xDD),
+			want: &Header{
+				Version:     V2,
+				Source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 25565},
+			},
+		},
+		{
+			name: "v2 TCP over IPv6",
+			input: v2(append(append(append([]byte{0x21, 0x21, 0x00, 0x24},
+				net.ParseIP("2001:db8::1")...), net.ParseIP("2001:db8::2")...), 0xDC, 0x04, 0x63, 0xDD)...),
+			want: &Header{
+				Version:     V2,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 25565},
+			},
+		},
+		{
+			name:  "v2 TLVs are skipped",
+			input: v2(0x21, 0x11, 0x00, 0x0F, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x63, 0xDD, 0x04, 0x00, 0x00),
+			want: &Header{
+				Version:     V2,
+				Source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 25565},
+			},
+		},
+		{
+			name:  "v2 LOCAL",
+			input: v2(0x20, 0x00, 0x00, 0x00),
+			want:  &Header{Version: V2},
+		},
+		{
+			name:  "v2 LOCAL with addresses",
+			input: v2(0x20, 0x11, 0x00, 0x0C, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x63, 0xDD),
+			want:  &Header{Version: V2},
+		},
+		{
+			name:  "v2 unspecified family",
+			input: v2(0x21, 0x00, 0x00, 0x00),
+			want:  &Header{Version: V2},
+		},
+		{
+			name:    "v2 unsupported version",
+			input:   v2(0x11, 0x11, 0x00, 0x00),
+			wantErr: "unsupported v2 version 1",
+		},
+		{
+			name:    "v2 truncated",
+			input:   v2(0x21, 0x11),
+			wantErr: "failed to read v2 header",
+		},
+		{
+			name:    "v2 truncated addresses",
+			input:   v2(0x21, 0x11, 0x00, 0x0C, 192, 0, 2, 1),
+			wantErr: "failed to read v2 addresses",
+		},
+		{
+			name:    "v2 address block too short",
+			input:   v2(0x21, 0x11, 0x00, 0x04, 192, 0, 2, 1),
+			wantErr: "v2 address block is too short",
+		},
+		{
+			name:    "truncated signature",
+			input:   "PROXY",
+			wantErr: "failed to read header",
+		},
+		{
+			name:    "not a header",
+			input:   "\x10\x00\xfb\x05\x09localhost\x63\xdd\x01",
+			wantErr: "did not start with a PROXY protocol header",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr != "" {
+				_, err := ReadHeader(strings.NewReader(tt.input))
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadHeader() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			// Data after the header must not be consumed.
+			const payload = "payload"
+			r := strings.NewReader(tt.input + payload)
+
+			got, err := ReadHeader(r)
+			if err != nil {
+				t.Fatalf("ReadHeader() error = %v", err)
+			}
+
+			assertHeader(t, got, tt.want)
+			if rest, _ := io.ReadAll(r); string(rest) != payload {
+				t.Errorf("ReadHeader() left %q unread, want %q", rest, payload)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	v4Src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	v4Dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 25565}
+	v6Src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	v6Dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 25565}
+
+	tests := []struct {
+		name   string
+		header *Header
+		want   string
+
+		// wantHeader is the header expected to be read back, if it
+		// differs from the formatted one.
+		wantHeader *Header
+	}{
+		{
+			name:   "v1 TCP4",
+			header: &Header{Version: V1, Source: v4Src, Destination: v4Dst},
+			want:   "PROXY TCP4 192.0.2.1 198.51.100.1 56324 25565\r\n",
+		},
+		{
+			name:   "v1 TCP6",
+			header: &Header{Version: V1, Source: v6Src, Destination: v6Dst},
+			want:   "PROXY TCP6 2001:db8::1 2001:db8::2 56324 25565\r\n",
+		},
+		{
+			name:   "v1 mixed families are mapped",
+			header: &Header{Version: V1, Source: v4Src, Destination: v6Dst},
+			want:   "PROXY TCP6 ::ffff:192.0.2.1 2001:db8::2 56324 25565\r\n",
+		},
+		{
+			name:   "v1 without addresses",
+			header: &Header{Version: V1, Source: &net.UnixAddr{Name: "sock"}, Destination: v4Dst},
+			want:   "PROXY UNKNOWN\r\n",
+
+			wantHeader: &Header{Version: V1},
+		},
+		{
+			name:   "v2 TCP over IPv4",
+			header: &Header{Version: V2, Source: v4Src, Destination: v4Dst},
+			want:   v2(0x21, 0x11, 0x00, 0x0C, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x63, 0xDD),
+		},
+		{
+			name:   "v2 TCP over IPv6",
+			header: &Header{Version: V2, Source: v6Src, Destination: v6Dst},
+			want: v2(append(append(append([]byte{0x21, 0x21, 0x00, 0x24},
+				net.ParseIP("2001:db8::1")...), net.ParseIP("2001:db8::2")...), 0xDC, 0x04, 0x63, 0xDD)...),
+		},
+		{
+			name:   "v2 without addresses",
+			header: &Header{Version: V2},
+			want:   v2(0x20, 0x00, 0x00, 0x00),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.header.Format()
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Format() = %q, want %q", got, tt.want)
+			}
+
+			read, err := ReadHeader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("ReadHeader() error = %v", err)
+			}
+
+			want := tt.wantHeader
+			if want == nil {
+				want = tt.header
+			}
+			assertHeader(t, read, want)
+		})
+	}
+}
+
+func TestFormatUnknownVersion(t *testing.T) {
+	if _, err := (&Header{Version: 3}).Format(); err == nil {
+		t.Fatal("Format() error = nil, want an error")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for s, want := range map[string]Version{"v1": V1, "v2": V2} {
+		if got, err := ParseVersion(s); err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	if _, err := ParseVersion("v3"); err == nil {
+		t.Error("ParseVersion(\"v3\") error = nil, want an error")
+	}
+}
+
+func TestListenerIsTrusted(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		addr    net.Addr
+		want    bool
+	}{
+		{"in trusted network", []*net.IPNet{trusted}, &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}, true},
+		{"outside trusted network", []*net.IPNet{trusted}, &net.TCPAddr{IP: net.ParseIP("192.0.2.1")}, false},
+		{"not a TCP address", []*net.IPNet{trusted}, &net.UnixAddr{Name: "sock"}, false},
+		{"no trusted networks", nil, &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Listener{Trusted: tt.trusted}
+			if got := l.isTrusted(tt.addr); got != tt.want {
+				t.Errorf("isTrusted(%v) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+// assertHeader fails the test if got doesn't equal want.
+func assertHeader(t *testing.T, got, want *Header) {
+	t.Helper()
+
+	if got.Version != want.Version {
+		t.Errorf("Version = %v, want %v", got.Version, want.Version)
+	}
+	assertAddr(t, "Source", got.Source, want.Source)
+	assertAddr(t, "Destination", got.Destination, want.Destination)
+}
+
+// assertAddr fails the test if got isn't the same TCP address as want.
+func assertAddr(t *testing.T, name string, got, want net.Addr) {
+	t.Helper()
+
+	if want == nil {
+		if got != nil {
+			t.Errorf("%s = %v, want nil", name, got)
+		}
+		return
+	}
+
+	gotTCP, ok := got.(*net.TCPAddr)
+	wantTCP := want.(*net.TCPAddr)
+	if !ok || !gotTCP.IP.Equal(wantTCP.IP) || gotTCP.Port != wantTCP.Port {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package ratelimit implements limiting the rate of events, and the
+// number of concurrent connections, per source IP.
+package ratelimit
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that are full, and so are the same
+// as no bucket, are removed.
+const sweepInterval = time.Minute
+
+// Contains the prefix lengths of the networks sources are grouped into.
+const (
+	networkBitsIPv4 = 24
+	networkBitsIPv6 = 64
+)
+
+// Limiter limits the rate of events per source IP, and per source
+// network (/24 for IPv4, /64 for IPv6), using token buckets.
+type Limiter struct {
+	// mu guards both sets of buckets, so an event only takes a token
+	// from either if both have one.
+	mu        sync.Mutex
+	ip        *buckets
+	network   *buckets
+	lastSweep time.Time
+}
+
+// New creates a limiter allowing rate events per second, and at most
+// burst at once, per source IP, and networkRate events per second, and
+// at most networkBurst at once, per source network. A rate of 0 disables
+// the limit.
+func New(rate float64, burst int, networkRate float64, networkBurst int) *Limiter {
+	return &Limiter{
+		ip:        newBuckets(rate, burst),
+		network:   newBuckets(networkRate, networkBurst),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow returns true if an event from the provided IP is allowed, taking
+// a token from its buckets if so.
+func (l *Limiter) Allow(ip netip.Addr) bool {
+	return l.allow(ip, time.Now())
+}
+
+// allow implements Allow at the provided time. Tokens are only taken if
+// both the IP and its network have one, so events rejected by one limit
+// don't use up the other.
+func (l *Limiter) allow(ip netip.Addr, now time.Time) bool {
+	if !ip.IsValid() {
+		return true
+	}
+
+	ip = ip.Unmap()
+	bits := networkBitsIPv6
+	if ip.Is4() {
+		bits = networkBitsIPv4
+	}
+	network, err := ip.Prefix(bits)
+	if err != nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.network.sweep(now)
+		l.ip.sweep(now)
+		l.lastSweep = now
+	}
+
+	networkBkt := l.network.get(network, now)
+	ipBkt := l.ip.get(netip.PrefixFrom(ip, ip.BitLen()), now)
+	if !networkBkt.available() || !ipBkt.available() {
+		return false
+	}
+
+	networkBkt.take()
+	ipBkt.take()
+	return true
+}
+
+// buckets are token buckets keyed by source.
+type buckets struct {
+	rate    float64
+	burst   float64
+	buckets map[netip.Prefix]*bucket
+}
+
+// bucket is a token bucket. A nil bucket is unlimited.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newBuckets creates token buckets with the provided rate and burst.
+func newBuckets(rate float64, burst int) *buckets {
+	return &buckets{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[netip.Prefix]*bucket),
+	}
+}
+
+// get returns the bucket of the provided source, refilled up to now, or
+// nil if the limit is disabled.
+func (b *buckets) get(key netip.Prefix, now time.Time) *bucket {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	bkt, ok := b.buckets[key]
+	if !ok {
+		bkt = &bucket{tokens: b.burst, updated: now}
+		b.buckets[key] = bkt
+	}
+
+	bkt.tokens = b.refill(bkt, now)
+	bkt.updated = now
+	return bkt
+}
+
+// refill returns the number of tokens in the bucket at now.
+func (b *buckets) refill(bkt *bucket, now time.Time) float64 {
+	return min(bkt.tokens+now.Sub(bkt.updated).Seconds()*b.rate, b.burst)
+}
+
+// sweep removes all buckets that are full, and so are the same as no
+// bucket.
+func (b *buckets) sweep(now time.Time) {
+	for key, bkt := range b.buckets {
+		if b.refill(bkt, now) >= b.burst {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// available returns true if the bucket has a token.
+func (bkt *bucket) available() bool {
+	return bkt == nil || bkt.tokens >= 1
+}
+
+// take takes a token from the bucket. It must be available.
+func (bkt *bucket) take() {
+	if bkt != nil {
+		bkt.tokens--
+	}
+}
+
+// Counter limits the number of concurrent connections per source IP.
+type Counter struct {
+	max int
+
+	mu     sync.Mutex
+	counts map[netip.Addr]int
+}
+
+// NewCounter creates a counter allowing max concurrent connections per
+// source IP. A max of 0 disables the limit.
+//
+//nolint:gocritic // Why: OK shadowing max.
+func NewCounter(max int) *Counter {
+	return &Counter{max: max, counts: make(map[netip.Addr]int)}
+}
+
+// Acquire returns true if another connection from the provided IP is
+// allowed, counting it if so. Every successful call must be paired with
+// a call to Release.
+func (c *Counter) Acquire(ip netip.Addr) bool {
+	if c.max <= 0 || !ip.IsValid() {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ip = ip.Unmap()
+	if c.counts[ip] >= c.max {
+		return false
+	}
+	c.counts[ip]++
+	return true
+}
+
+// Release stops counting a connection from the provided IP.
+func (c *Counter) Release(ip netip.Addr) {
+	if c.max <= 0 || !ip.IsValid() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ip = ip.Unmap()
+	if c.counts[ip]--; c.counts[ip] <= 0 {
+		delete(c.counts, ip)
+	}
+}
+
+// SourceIP returns the IP of the provided address, or the zero
+// netip.Addr if it isn't a TCP address.
+func SourceIP(addr net.Addr) netip.Addr {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}
+	}
+
+	ip, _ := netip.AddrFromSlice(tcp.IP)
+	return ip.Unmap()
+}
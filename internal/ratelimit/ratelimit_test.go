@@ -0,0 +1,235 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ratelimit
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	l := New(1, 2, 0, 0)
+	for i := range 2 {
+		if !l.allow(ip, now) {
+			t.Fatalf("allow() #%d = false, want true within burst", i)
+		}
+	}
+	if l.allow(ip, now) {
+		t.Fatal("allow() = true, want false after burst")
+	}
+
+	// Other IPs have their own bucket.
+	if !l.allow(netip.MustParseAddr("192.0.2.2"), now) {
+		t.Error("allow() = false for another IP, want true")
+	}
+
+	// Tokens refill at rate, up to burst.
+	if !l.allow(ip, now.Add(time.Second)) {
+		t.Error("allow() = false after refill, want true")
+	}
+	if l.allow(ip, now.Add(time.Second)) {
+		t.Error("allow() = true after refilling one token, want false")
+	}
+	later := now.Add(time.Hour)
+	for i := range 2 {
+		if !l.allow(ip, later) {
+			t.Fatalf("allow() #%d = false after full refill, want true", i)
+		}
+	}
+	if l.allow(ip, later) {
+		t.Error("allow() = true, want refill capped at burst")
+	}
+}
+
+func TestLimiterAllowNetwork(t *testing.T) {
+	now := time.Now()
+
+	l := New(0, 0, 1, 2)
+	if !l.allow(netip.MustParseAddr("192.0.2.1"), now) || !l.allow(netip.MustParseAddr("192.0.2.2"), now) {
+		t.Fatal("allow() = false within network burst, want true")
+	}
+	if l.allow(netip.MustParseAddr("192.0.2.3"), now) {
+		t.Error("allow() = true for exhausted /24, want false")
+	}
+	if !l.allow(netip.MustParseAddr("192.0.3.1"), now) {
+		t.Error("allow() = false for another /24, want true")
+	}
+
+	// IPv4-mapped IPv6 addresses share their IPv4 network.
+	if l.allow(netip.MustParseAddr("::ffff:192.0.2.4"), now) {
+		t.Error("allow() = true for mapped IPv4 in exhausted /24, want false")
+	}
+
+	v6 := New(0, 0, 1, 1)
+	if !v6.allow(netip.MustParseAddr("2001:db8::1"), now) {
+		t.Fatal("allow() = false within network burst, want true")
+	}
+	if v6.allow(netip.MustParseAddr("2001:db8::ffff:1"), now) {
+		t.Error("allow() = true for exhausted /64, want false")
+	}
+	if !v6.allow(netip.MustParseAddr("2001:db8:0:1::1"), now) {
+		t.Error("allow() = false for another /64, want true")
+	}
+}
+
+// TestLimiterAllowChecksBothBuckets ensures events rejected by one
+// limit don't take a token from the other.
+func TestLimiterAllowChecksBothBuckets(t *testing.T) {
+	now := time.Now()
+	limited := netip.MustParseAddr("192.0.2.1")
+	other := netip.MustParseAddr("192.0.2.2")
+
+	l := New(1, 1, 1, 3)
+	if !l.allow(limited, now) {
+		t.Fatal("allow() = false, want true")
+	}
+
+	// Rejected by the IP limit, which mustn't drain the network bucket.
+	for range 10 {
+		if l.allow(limited, now) {
+			t.Fatal("allow() = true for exhausted IP, want false")
+		}
+	}
+	for _, ip := range []string{"192.0.2.2", "192.0.2.3"} {
+		if !l.allow(netip.MustParseAddr(ip), now) {
+			t.Fatalf("allow() = false for %s, want network tokens left", ip)
+		}
+	}
+
+	// Rejected by the network limit, which mustn't drain the IP bucket.
+	l = New(1, 1, 1, 1)
+	if !l.allow(limited, now) {
+		t.Fatal("allow() = false, want true")
+	}
+	if l.allow(other, now) {
+		t.Fatal("allow() = true for exhausted network, want false")
+	}
+	if !l.allow(other, now.Add(time.Second)) {
+		t.Error("allow() = false after network refill, want IP token left")
+	}
+}
+
+func TestLimiterAllowUnlimited(t *testing.T) {
+	now := time.Now()
+
+	l := New(0, 0, 0, 0)
+	for range 100 {
+		if !l.allow(netip.MustParseAddr("192.0.2.1"), now) {
+			t.Fatal("allow() = false with limits disabled, want true")
+		}
+	}
+
+	// Invalid sources, e.g. non-TCP addresses, aren't limited.
+	l = New(1, 1, 1, 1)
+	for range 10 {
+		if !l.allow(netip.Addr{}, now) {
+			t.Fatal("allow() = false for invalid IP, want true")
+		}
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Now()
+
+	l := New(1, 1, 1, 1)
+	l.allow(netip.MustParseAddr("192.0.2.1"), now)
+	l.allow(netip.MustParseAddr("198.51.100.1"), now.Add(sweepInterval))
+	if len(l.ip.buckets) != 2 || len(l.network.buckets) != 2 {
+		t.Fatalf("got %d IP and %d network buckets, want 2", len(l.ip.buckets), len(l.network.buckets))
+	}
+
+	// Only the full bucket is removed.
+	l.allow(netip.MustParseAddr("203.0.113.1"), now.Add(sweepInterval+time.Millisecond))
+	if _, ok := l.ip.buckets[netip.MustParsePrefix("192.0.2.1/32")]; ok {
+		t.Error("full IP bucket wasn't swept")
+	}
+	if _, ok := l.network.buckets[netip.MustParsePrefix("192.0.2.0/24")]; ok {
+		t.Error("full network bucket wasn't swept")
+	}
+	if len(l.ip.buckets) != 2 || len(l.network.buckets) != 2 {
+		t.Errorf("got %d IP and %d network buckets, want 2", len(l.ip.buckets), len(l.network.buckets))
+	}
+}
+
+func TestCounter(t *testing.T) {
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	c := NewCounter(2)
+	if !c.Acquire(ip) || !c.Acquire(netip.MustParseAddr("::ffff:192.0.2.1")) {
+		t.Fatal("Acquire() = false within max, want true")
+	}
+	if c.Acquire(ip) {
+		t.Fatal("Acquire() = true over max, want false")
+	}
+	if !c.Acquire(netip.MustParseAddr("192.0.2.2")) {
+		t.Error("Acquire() = false for another IP, want true")
+	}
+
+	c.Release(ip)
+	if !c.Acquire(ip) {
+		t.Error("Acquire() = false after Release, want true")
+	}
+
+	c.Release(ip)
+	c.Release(ip)
+	if _, ok := c.counts[ip]; ok {
+		t.Error("count wasn't removed after releasing every connection")
+	}
+
+	unlimited := NewCounter(0)
+	for range 10 {
+		if !unlimited.Acquire(ip) {
+			t.Fatal("Acquire() = false with limit disabled, want true")
+		}
+	}
+}
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		name string
+		addr net.Addr
+		want netip.Addr
+	}{
+		{
+			name: "IPv4",
+			addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 25565},
+			want: netip.MustParseAddr("192.0.2.1"),
+		},
+		{
+			name: "IPv6",
+			addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 25565},
+			want: netip.MustParseAddr("2001:db8::1"),
+		},
+		{
+			name: "non-TCP",
+			addr: &net.UnixAddr{Name: "/tmp/sock", Net: "unix"},
+			want: netip.Addr{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SourceIP(tt.addr); got != tt.want {
+				t.Errorf("SourceIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package rcon implements a client for the Source RCON protocol, which
+// Minecraft servers use for remote administration.
+//
+// See: https://minecraft.wiki/w/RCON
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Contains the packet types used by the protocol.
+const (
+	packetTypeResponse int32 = 0
+	packetTypeCommand  int32 = 2
+	packetTypeLogin    int32 = 3
+)
+
+// maxPacketLength is the maximum length of a packet we accept.
+// Responses are at most 4096 bytes of payload.
+const maxPacketLength = 4096 + 10
+
+// Client is a connection to an RCON server.
+type Client struct {
+	conn net.Conn
+
+	// timeout is the timeout for each request.
+	timeout time.Duration
+
+	// requestID is the ID of the last request sent.
+	requestID int32
+}
+
+// Dial connects to the RCON server at the provided address and logs in
+// with the provided password. timeout bounds connecting and every
+// request made with the client.
+func Dial(addr, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	c := &Client{conn: conn, timeout: timeout}
+	id, _, err := c.request(packetTypeLogin, password)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to login: %w", err)
+	}
+
+	// Failed logins are answered with a request ID of -1.
+	if id == -1 {
+		conn.Close()
+		return nil, fmt.Errorf("failed to login: invalid password")
+	}
+
+	return c, nil
+}
+
+// Command runs the provided command and returns its output.
+func (c *Client) Command(cmd string) (string, error) {
+	_, body, err := c.request(packetTypeCommand, cmd)
+	return body, err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// request sends a request and reads the response to it. It returns the
+// request ID and body of the response.
+func (c *Client) request(typ int32, body string) (int32, string, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, "", err
+	}
+
+	c.requestID++
+	if err := c.write(c.requestID, typ, body); err != nil {
+		return 0, "", fmt.Errorf("failed to send request: %w", err)
+	}
+
+	for {
+		id, respType, respBody, err := c.read()
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to read response: %w", err)
+		}
+
+		// Login requests are preceded by an empty response, skip it.
+		if typ == packetTypeLogin && respType == packetTypeResponse {
+			continue
+		}
+
+		return id, respBody, nil
+	}
+}
+
+// write writes a packet.
+func (c *Client) write(id, typ int32, body string) error {
+	var b bytes.Buffer
+
+	// length, request ID and type, followed by the null terminated body
+	// and an empty null terminated string.
+	for _, v := range []int32{int32(len(body) + 10), id, typ} { //nolint:gosec // Why: Commands are short.
+		if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	b.WriteString(body)
+	b.Write([]byte{0, 0})
+
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+// read reads a packet.
+func (c *Client) read() (id, typ int32, body string, err error) {
+	var length int32
+	if err := binary.Read(c.conn, binary.LittleEndian, &length); err != nil {
+		return 0, 0, "", err
+	}
+	if length < 10 || length > maxPacketLength {
+		return 0, 0, "", fmt.Errorf("invalid packet length %d", length)
+	}
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		return 0, 0, "", err
+	}
+
+	id = int32(binary.LittleEndian.Uint32(b[0:4]))  //nolint:gosec // Why: Signed on the wire.
+	typ = int32(binary.LittleEndian.Uint32(b[4:8])) //nolint:gosec // Why: Signed on the wire.
+	return id, typ, string(bytes.TrimRight(b[8:], "\x00")), nil
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package schedule implements cron expressions, and recurring windows of
+// time starting at each activation of one.
+//
+// See: https://man7.org/linux/man-pages/man5/crontab.5.html
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchYears is how many years ahead Next looks for an activation,
+// before deciding the schedule never activates, e.g. "0 0 31 2 *".
+const searchYears = 5
+
+// macros contains the supported shorthands for common expressions.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field describes one of the fields of an expression.
+type field struct {
+	name     string
+	min, max int
+
+	// names maps names, e.g. "jan", to their values.
+	names map[string]int
+}
+
+// Contains the fields of an expression, in order.
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday is both 0 and 7.
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// bits is a set of the values of a field.
+type bits uint64
+
+// has returns true if the provided value is in the set.
+func (b bits) has(v int) bool {
+	return b&(1<<uint(v)) != 0 //nolint:gosec // Why: Values are at most 59.
+}
+
+// Schedule is a parsed cron expression, with minute resolution.
+type Schedule struct {
+	minutes, hours, doms, months, dows bits
+
+	// anyDOM and anyDOW are set when the day of month, or day of week,
+	// is "*". If neither is, a day matches if either does.
+	anyDOM, anyDOW bool
+}
+
+// Parse parses a standard five field cron expression: minute, hour, day
+// of month, month and day of week. Fields support "*", values, ranges
+// ("1-5"), steps ("*/15", "0-30/10") and lists ("1,3,5"). Months and days
+// of the week may be named ("jan", "mon"). The @yearly, @monthly,
+// @weekly, @daily and @hourly shorthands are also supported.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{
+		anyDOM: strings.HasPrefix(fields[2], "*"),
+		anyDOW: strings.HasPrefix(fields[4], "*"),
+	}
+	for i, dst := range []*bits{&s.minutes, &s.hours, &s.doms, &s.months, &s.dows} {
+		f := []field{minuteField, hourField, domField, monthField, dowField}[i]
+
+		b, err := f.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		*dst = b
+	}
+
+	// Sunday may be written as 7.
+	if s.dows.has(7) {
+		s.dows |= 1
+	}
+
+	return s, nil
+}
+
+// parse parses a field of an expression.
+func (f *field) parse(s string) (bits, error) {
+	var b bits
+	for item := range strings.SplitSeq(s, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepText)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			loText, hiText, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loText); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiText); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+
+			// "5/15" means every 15 starting at 5.
+			hi = lo
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v) //nolint:gosec // Why: Values are checked by value.
+		}
+	}
+
+	return b, nil
+}
+
+// value parses a single value of the field, by number or by name.
+func (f *field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+
+	return v, nil
+}
+
+// Next returns the first activation of the schedule after t, in t's
+// location. The zero time is returned if the schedule never activates.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Year() + searchYears
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Year() <= limit {
+		switch {
+		case !s.months.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hours.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.minutes.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches returns true if the day of t matches the schedule.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.doms.has(t.Day()), s.dows.has(int(t.Weekday()))
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// Window is a recurring period of time, starting at every activation of
+// a schedule.
+type Window struct {
+	// Schedule activates the window.
+	Schedule *Schedule
+
+	// Duration is how long the window lasts.
+	Duration time.Duration
+}
+
+// Active returns true if t is within the window, along with when the
+// window ends.
+func (w *Window) Active(t time.Time) (time.Time, bool) {
+	var end time.Time
+
+	// The latest activation before t decides when the window ends.
+	for start := w.Schedule.Next(t.Add(-w.Duration)); !start.IsZero() && !start.After(t); start = w.Schedule.Next(start) {
+		end = start.Add(w.Duration)
+	}
+
+	return end, !end.IsZero()
+}
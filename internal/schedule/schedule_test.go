@@ -0,0 +1,252 @@
+// Copyright (C) 2026 Jared Allard <jared@rgst.io>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// mustParse parses the provided expression, failing the test if it's
+// invalid.
+func mustParse(t *testing.T, expr string) *Schedule {
+	t.Helper()
+
+	s, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", expr, err)
+	}
+	return s
+}
+
+// date returns the provided time in UTC.
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "  0 4 * * 1-5  "},
+		{expr: "*/15 0-6/2 1,15 jan-mar MON,wed"},
+		{expr: "5/15 * * * *"},
+		{expr: "0 0 * * 7"},
+		{expr: "@daily"},
+		{expr: "@Hourly"},
+		{expr: "", wantErr: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "* * * foo *", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "*/x * * * *", wantErr: true},
+		{expr: "1-x * * * *", wantErr: true},
+		{expr: "@reboot", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2026-01-01 is a Thursday.
+	from := date(2026, time.January, 1, 12, 30)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "every minute is strictly after",
+			expr: "* * * * *",
+			from: from,
+			want: date(2026, time.January, 1, 12, 31),
+		},
+		{
+			name: "seconds are truncated",
+			expr: "* * * * *",
+			from: from.Add(59 * time.Second),
+			want: date(2026, time.January, 1, 12, 31),
+		},
+		{
+			name: "later today",
+			expr: "0 18 * * *",
+			from: from,
+			want: date(2026, time.January, 1, 18, 0),
+		},
+		{
+			name: "tomorrow",
+			expr: "0 4 * * *",
+			from: from,
+			want: date(2026, time.January, 2, 4, 0),
+		},
+		{
+			name: "steps",
+			expr: "*/20 * * * *",
+			from: from,
+			want: date(2026, time.January, 1, 12, 40),
+		},
+		{
+			name: "step from a value",
+			expr: "5/20 * * * *",
+			from: date(2026, time.January, 1, 12, 50),
+			want: date(2026, time.January, 1, 13, 5),
+		},
+		{
+			name: "named day of week",
+			expr: "0 0 * * mon",
+			from: from,
+			want: date(2026, time.January, 5, 0, 0),
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			from: from,
+			want: date(2026, time.January, 4, 0, 0),
+		},
+		{
+			name: "named month",
+			expr: "0 0 1 mar *",
+			from: from,
+			want: date(2026, time.March, 1, 0, 0),
+		},
+		{
+			name: "next year",
+			expr: "@yearly",
+			from: from,
+			want: date(2027, time.January, 1, 0, 0),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: from,
+			want: date(2028, time.February, 29, 0, 0),
+		},
+		{
+			// Either the 15th or a Monday, as neither is "*".
+			name: "day of month or day of week",
+			expr: "0 0 15 * mon",
+			from: date(2026, time.January, 6, 0, 0),
+			want: date(2026, time.January, 12, 0, 0),
+		},
+		{
+			name: "day of month or day of week, day of month first",
+			expr: "0 0 15 * mon",
+			from: date(2026, time.January, 13, 0, 0),
+			want: date(2026, time.January, 15, 0, 0),
+		},
+		{
+			// Both must match, as the day of week starts with "*",
+			// so Friday the 2nd is skipped for Saturday the 3rd.
+			name: "day of month and stepped day of week",
+			expr: "0 0 1-7 * */2",
+			from: from,
+			want: date(2026, time.January, 3, 0, 0),
+		},
+		{
+			name: "day of month only",
+			expr: "0 0 15 * *",
+			from: from,
+			want: date(2026, time.January, 15, 0, 0),
+		},
+		{
+			name: "day of week only",
+			expr: "0 0 * * sat",
+			from: from,
+			want: date(2026, time.January, 3, 0, 0),
+		},
+		{
+			name: "never",
+			expr: "0 0 31 2 *",
+			from: from,
+			want: time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustParse(t, tt.expr).Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+
+	got := mustParse(t, "0 4 * * *").Next(time.Date(2026, time.January, 1, 12, 0, 0, 0, loc))
+	if want := time.Date(2026, time.January, 2, 4, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+	if got.Location() != loc {
+		t.Errorf("Next() location = %v, want %v", got.Location(), loc)
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	w := &Window{Schedule: mustParse(t, "0 4 * * *"), Duration: 2 * time.Hour}
+	end := date(2026, time.January, 2, 6, 0)
+
+	tests := []struct {
+		name       string
+		t          time.Time
+		wantEnd    time.Time
+		wantActive bool
+	}{
+		{name: "before", t: date(2026, time.January, 2, 3, 59)},
+		{name: "start", t: date(2026, time.January, 2, 4, 0), wantEnd: end, wantActive: true},
+		{name: "during", t: date(2026, time.January, 2, 5, 59), wantEnd: end, wantActive: true},
+		{name: "end", t: end},
+		{name: "after", t: date(2026, time.January, 2, 12, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotEnd, gotActive := w.Active(tt.t)
+			if gotActive != tt.wantActive || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("Active(%v) = (%v, %v), want (%v, %v)", tt.t, gotEnd, gotActive, tt.wantEnd, tt.wantActive)
+			}
+		})
+	}
+}
+
+// TestWindowActiveOverlapping ensures overlapping windows end at the end
+// of the latest one.
+func TestWindowActiveOverlapping(t *testing.T) {
+	w := &Window{Schedule: mustParse(t, "0 * * * *"), Duration: 90 * time.Minute}
+
+	gotEnd, gotActive := w.Active(date(2026, time.January, 1, 1, 15))
+	if want := date(2026, time.January, 1, 2, 30); !gotActive || !gotEnd.Equal(want) {
+		t.Errorf("Active() = (%v, %v), want (%v, true)", gotEnd, gotActive, want)
+	}
+}